@@ -0,0 +1,286 @@
+package arc
+
+import (
+	"container/list"
+	"module/lru"
+	"time"
+	"unsafe"
+)
+
+// ARC（Adaptive Replacement Cache）缓存。
+// t1存只访问过一次的节点，t2存访问过至少两次的节点；
+// b1、b2是 ghost链表，只记住最近从 t1、t2淘汰的 key和大小，不存值。
+// 在 b1里再次遇到某个 key，说明 t1太小了，p变大；在 b2里遇到说明 t2太小了，p变小。
+// p是 t1的目标大小，这样不用调参数就能在"最近访问"和"经常访问"之间自动调整，
+// 一次性的大范围扫描只会冲掉 t1，不会影响 t2里的热点数据。
+// 和 lru.Cache一样按内存计算：t1 + t2 <= maxBytes，四个链表加起来 <= 2 * maxBytes
+type Cache[K comparable, V any] struct {
+	maxBytes  int64 // 允许使用的最大内存
+	nbytes    int64 // 当前已经使用的内存，t1和 t2的和，不包括 ghost
+	p         int64 // t1的目标大小
+	size      func(key K, value V) int64
+	items     map[K]*list.Element // 四个链表里的节点都在这里
+	t1, t2    *arcList
+	b1, b2    *arcList
+	OnEvicted func(key K, value V, reason lru.EvictReason) // 某条记录被移除时的回调函数，移到 ghost链表也算移除
+
+	evictions int64 // 因为内存或者过期被淘汰的节点个数
+	now       func() time.Time
+}
+
+// 双向链表和链表里节点的总大小，Front是最近访问的
+type arcList struct {
+	ll    *list.List
+	bytes int64
+}
+
+type entry[K comparable, V any] struct {
+	key    K
+	value  V // ghost节点的值是零值
+	size   int64
+	expire time.Time // 过期时间，零值表示永不过期
+	in     *arcList  // 在哪个链表里
+}
+
+func (e *entry[K, V]) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+// 实例化 ARC缓存，maxBytes和 size见 lru.NewCache
+func NewCache[K comparable, V any](maxBytes int64, size func(key K, value V) int64) *Cache[K, V] {
+	if size == nil {
+		size = func(K, V) int64 { return 1 }
+	}
+	newList := func() *arcList { return &arcList{ll: list.New()} }
+	return &Cache[K, V]{
+		maxBytes: maxBytes,
+		size:     size,
+		items:    make(map[K]*list.Element),
+		t1:       newList(),
+		t2:       newList(),
+		b1:       newList(),
+		b2:       newList(),
+		now:      time.Now,
+	}
+}
+
+// 见 lru.EntryOverhead。ghost节点也占这么多，但是不在 Bytes里，由 HeapBytes另算
+func EntryOverhead[K comparable, V any]() int64 {
+	var k K
+	return lru.NodeOverhead(unsafe.Sizeof(entry[K, V]{}), unsafe.Sizeof(k))
+}
+
+// 把节点移到链表 to的最前面，ele是节点在原来链表里的位置，nil表示新节点
+func (c *Cache[K, V]) moveTo(ele *list.Element, e *entry[K, V], to *arcList) {
+	if ele != nil {
+		e.in.ll.Remove(ele)
+		e.in.bytes -= e.size
+	}
+	e.in = to
+	to.bytes += e.size
+	c.items[e.key] = to.ll.PushFront(e)
+}
+
+// 从所有链表里删除节点
+func (c *Cache[K, V]) delete(ele *list.Element) *entry[K, V] {
+	e := ele.Value.(*entry[K, V])
+	e.in.ll.Remove(ele)
+	e.in.bytes -= e.size
+	delete(c.items, e.key)
+	return e
+}
+
+func (c *Cache[K, V]) resident(e *entry[K, V]) bool {
+	return e.in == c.t1 || e.in == c.t2
+}
+
+// 查找 key，命中后移到 t2的最前面。过期的节点惰性删除
+func (c *Cache[K, V]) Get(key K) (value V, ok bool) {
+	ele, ok := c.items[key]
+	if !ok {
+		return
+	}
+	e := ele.Value.(*entry[K, V])
+	if !c.resident(e) {
+		return value, false
+	}
+	if e.expired(c.now()) {
+		c.removeResident(ele, lru.EvictExpired)
+		return value, false
+	}
+	c.moveTo(ele, e, c.t2)
+	return e.value, true
+}
+
+// key是否存在并且没有过期，不改变节点的位置
+func (c *Cache[K, V]) Contains(key K) bool {
+	ele, ok := c.items[key]
+	if !ok {
+		return false
+	}
+	e := ele.Value.(*entry[K, V])
+	return c.resident(e) && !e.expired(c.now())
+}
+
+func (c *Cache[K, V]) Add(key K, value V) {
+	c.AddWithTTL(key, value, 0)
+}
+
+// 加入或者更新 key，ttl <= 0 表示永不过期
+func (c *Cache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = c.now().Add(ttl)
+	}
+	size := c.size(key, value)
+
+	ele, ok := c.items[key]
+	if !ok {
+		c.addNew(key, value, size, expire)
+		return
+	}
+	e := ele.Value.(*entry[K, V])
+	switch e.in {
+	case c.t1, c.t2: // 更新已有的值，算作一次访问
+		e.in.bytes += size - e.size
+		c.nbytes += size - e.size
+		e.value, e.size, e.expire = value, size, expire
+		c.moveTo(ele, e, c.t2)
+	case c.b1: // 最近从 t1淘汰的 key又来了，t1应该大一点
+		c.p += e.size * ratio(c.b2.bytes, c.b1.bytes)
+		if c.p > c.maxBytes {
+			c.p = c.maxBytes
+		}
+		c.delete(ele)
+		c.makeRoom(size, false)
+		c.insert(key, value, size, expire, c.t2)
+	case c.b2: // 最近从 t2淘汰的 key又来了，t2应该大一点
+		c.p -= e.size * ratio(c.b1.bytes, c.b2.bytes)
+		if c.p < 0 {
+			c.p = 0
+		}
+		c.delete(ele)
+		c.makeRoom(size, true)
+		c.insert(key, value, size, expire, c.t2)
+	}
+	c.makeRoom(0, false)
+}
+
+// a / b，最小为 1
+func ratio(a, b int64) int64 {
+	if b == 0 || a <= b {
+		return 1
+	}
+	return a / b
+}
+
+// 加入一个四个链表里都没有的 key
+func (c *Cache[K, V]) addNew(key K, value V, size int64, expire time.Time) {
+	if c.maxBytes != 0 {
+		// ghost链表只是用来调整 p的，不能无限增长
+		for c.t1.bytes+c.b1.bytes+size > c.maxBytes && c.b1.ll.Len() > 0 {
+			c.delete(c.b1.ll.Back())
+		}
+		for c.t1.bytes+c.t2.bytes+c.b1.bytes+c.b2.bytes+size > 2*c.maxBytes && c.b2.ll.Len() > 0 {
+			c.delete(c.b2.ll.Back())
+		}
+	}
+	c.makeRoom(size, false)
+	c.insert(key, value, size, expire, c.t1)
+	c.makeRoom(0, false) // 节点本身比 maxBytes还大
+}
+
+func (c *Cache[K, V]) insert(key K, value V, size int64, expire time.Time, to *arcList) {
+	c.moveTo(nil, &entry[K, V]{key: key, value: value, size: size, expire: expire}, to)
+	c.nbytes += size
+}
+
+// 淘汰节点，直到再加入 size大小的节点也不超过 maxBytes。
+// inB2表示这次是 b2命中，t1正好等于 p时也优先淘汰 t1
+func (c *Cache[K, V]) makeRoom(size int64, inB2 bool) {
+	for c.maxBytes != 0 && c.nbytes+size > c.maxBytes && c.nbytes > 0 {
+		c.replace(inB2)
+	}
+}
+
+// ARC的 REPLACE：t1超过目标大小 p时淘汰 t1最久没访问的节点到 b1，否则淘汰 t2的到 b2
+func (c *Cache[K, V]) replace(inB2 bool) {
+	from, ghost := c.t2, c.b2
+	if c.t1.ll.Len() > 0 && (c.t1.bytes > c.p || (inB2 && c.t1.bytes == c.p) || c.t2.ll.Len() == 0) {
+		from, ghost = c.t1, c.b1
+	}
+	ele := from.ll.Back()
+	e := ele.Value.(*entry[K, V])
+	value := e.value
+	var zero V
+	e.value = zero // ghost节点不保留值
+	c.moveTo(ele, e, ghost)
+	c.nbytes -= e.size
+	c.evictions++
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, value, lru.EvictSize)
+	}
+}
+
+// 删除 t1或者 t2里的节点，不放进 ghost链表
+func (c *Cache[K, V]) removeResident(ele *list.Element, reason lru.EvictReason) {
+	e := c.delete(ele)
+	c.nbytes -= e.size
+	if reason != lru.EvictRemoved {
+		c.evictions++
+	}
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value, reason)
+	}
+}
+
+// 主动删除 key，ghost链表里的也一起删掉
+func (c *Cache[K, V]) Remove(key K) {
+	ele, ok := c.items[key]
+	if !ok {
+		return
+	}
+	if c.resident(ele.Value.(*entry[K, V])) {
+		c.removeResident(ele, lru.EvictRemoved)
+	} else {
+		c.delete(ele)
+	}
+}
+
+// 删除所有已经过期的节点，返回删除的个数
+func (c *Cache[K, V]) RemoveExpired() int {
+	now := c.now()
+	n := 0
+	for _, l := range []*arcList{c.t1, c.t2} {
+		for ele := l.ll.Back(); ele != nil; {
+			prev := ele.Prev()
+			if ele.Value.(*entry[K, V]).expired(now) {
+				c.removeResident(ele, lru.EvictExpired)
+				n++
+			}
+			ele = prev
+		}
+	}
+	return n
+}
+
+// 缓存里的节点个数，不包括 ghost
+func (c *Cache[K, V]) Len() int {
+	return c.t1.ll.Len() + c.t2.ll.Len()
+}
+
+// 当前已经使用的内存
+func (c *Cache[K, V]) Bytes() int64 {
+	return c.nbytes
+}
+
+// 估计的堆内存。size里加上了 EntryOverhead时，Bytes只包括 t1、t2的节点，
+// 这里再加上 ghost节点：ghost不保留值，按 EntryOverhead算，key本身的内存没有算
+func (c *Cache[K, V]) HeapBytes() int64 {
+	return c.nbytes + int64(c.b1.ll.Len()+c.b2.ll.Len())*EntryOverhead[K, V]()
+}
+
+// 被淘汰的节点总数
+func (c *Cache[K, V]) Evictions() int64 {
+	return c.evictions
+}
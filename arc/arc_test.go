@@ -0,0 +1,97 @@
+package arc
+
+import (
+	"module/lru"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGet(t *testing.T) {
+	arc := NewCache[string, string](0, nil)
+	arc.Add("k1", "1234")
+	if v, ok := arc.Get("k1"); !ok || v != "1234" {
+		t.Fatalf("cache hit k1=1234 failed")
+	}
+	if _, ok := arc.Get("k2"); ok {
+		t.Fatalf("cache miss k2 failed")
+	}
+}
+
+func TestScanResistant(t *testing.T) {
+	arc := NewCache[string, int](4, nil)
+	arc.Add("hot1", 1)
+	arc.Add("hot2", 2)
+	arc.Get("hot1")
+	arc.Get("hot2")
+	// 一次性扫描很多只访问一次的 key，只会冲掉 t1
+	for i := 0; i < 100; i++ {
+		arc.Add("scan"+strconv.Itoa(i), i)
+	}
+	if !arc.Contains("hot1") || !arc.Contains("hot2") {
+		t.Fatalf("hot keys should survive a scan")
+	}
+	if arc.Len() != 4 || arc.Bytes() != 4 {
+		t.Fatalf("Len = %d, Bytes = %d, want 4", arc.Len(), arc.Bytes())
+	}
+}
+
+func TestAdapt(t *testing.T) {
+	arc := NewCache[string, int](2, nil)
+	arc.Add("k1", 1)
+	arc.Add("k2", 2)
+	arc.Add("k3", 3) // k1淘汰到 b1
+	if arc.b1.ll.Len() != 1 || arc.p != 0 {
+		t.Fatalf("k1 should be in b1, p = %d", arc.p)
+	}
+	arc.Add("k1", 1) // b1命中，p变大，k1直接进 t2
+	if arc.p != 1 || !arc.Contains("k1") || arc.items["k1"].Value.(*entry[string, int]).in != arc.t2 {
+		t.Fatalf("ghost hit in b1 should grow p and promote k1 to t2, p = %d", arc.p)
+	}
+	if arc.t1.bytes+arc.t2.bytes+arc.b1.bytes+arc.b2.bytes > 4 {
+		t.Fatalf("lists exceed 2 * maxBytes")
+	}
+}
+
+func TestOnEvicted(t *testing.T) {
+	var reasons []lru.EvictReason
+	now := time.Now()
+	arc := NewCache[string, string](2, nil)
+	arc.now = func() time.Time { return now }
+	arc.OnEvicted = func(key string, value string, reason lru.EvictReason) {
+		reasons = append(reasons, reason)
+	}
+	arc.AddWithTTL("k1", "v1", time.Second)
+	arc.Add("k2", "v2")
+	arc.Add("k3", "v3")
+	arc.Remove("k3")
+	arc.AddWithTTL("k4", "v4", time.Second)
+	now = now.Add(time.Minute)
+	arc.Get("k4")
+
+	expect := []lru.EvictReason{lru.EvictSize, lru.EvictRemoved, lru.EvictExpired}
+	if !reflect.DeepEqual(expect, reasons) {
+		t.Fatalf("OnEvicted reasons = %v, want %v", reasons, expect)
+	}
+	if arc.Evictions() != 2 || arc.Len() != 1 {
+		t.Fatalf("Evictions = %d, Len = %d", arc.Evictions(), arc.Len())
+	}
+}
+
+// ghost节点不在 Bytes里，但要算进 HeapBytes
+func TestHeapBytes(t *testing.T) {
+	overhead := EntryOverhead[string, string]()
+	arc := NewCache[string, string](2*(overhead+4), func(key string, value string) int64 {
+		return int64(len(key)+len(value)) + overhead
+	})
+	for _, key := range []string{"k1", "k2", "k3"} {
+		arc.Add(key, "v")
+	}
+	if arc.Len() != 2 || arc.b1.ll.Len() != 1 {
+		t.Fatalf("Len = %d, ghosts = %d, want 2, 1", arc.Len(), arc.b1.ll.Len())
+	}
+	if got, want := arc.HeapBytes(), arc.Bytes()+overhead; got != want {
+		t.Fatalf("HeapBytes = %d, want %d", got, want)
+	}
+}
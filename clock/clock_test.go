@@ -0,0 +1,112 @@
+package clock
+
+import (
+	"module/lru"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGet(t *testing.T) {
+	c := NewCache[string, string](0, nil)
+	c.Add("k1", "1234")
+	if v, ok := c.Get("k1"); !ok || v != "1234" {
+		t.Fatalf("cache hit k1=1234 failed")
+	}
+	if _, ok := c.Get("k2"); ok {
+		t.Fatalf("cache miss k2 failed")
+	}
+}
+
+func TestEvict(t *testing.T) {
+	c := NewCache[string, int](3, nil)
+	c.Add("k1", 1)
+	c.Add("k2", 2)
+	c.Add("k3", 3)
+	c.Get("k1")
+	c.Add("k4", 4) // k1访问过，跳过并清除标记，淘汰 k2
+	c.Add("k5", 5) // 接着从 k3开始，淘汰 k3
+	for _, key := range []string{"k1", "k4", "k5"} {
+		if !c.Contains(key) {
+			t.Fatalf("%s should be kept", key)
+		}
+	}
+	if c.Len() != 3 || c.Evictions() != 2 {
+		t.Fatalf("Len = %d, Evictions = %d", c.Len(), c.Evictions())
+	}
+	// 都访问过的时候，新加入的 key不能把自己淘汰掉
+	for _, key := range []string{"k1", "k4", "k5"} {
+		c.Get(key)
+	}
+	c.Add("k6", 6)
+	if !c.Contains("k6") || c.Len() != 3 {
+		t.Fatalf("new key k6 should be kept")
+	}
+}
+
+func TestOnEvicted(t *testing.T) {
+	var reasons []lru.EvictReason
+	now := time.Now()
+	c := NewCache[string, string](2, nil)
+	c.now = func() time.Time { return now }
+	c.OnEvicted = func(key string, value string, reason lru.EvictReason) {
+		reasons = append(reasons, reason)
+	}
+	c.Add("k1", "v1")
+	c.AddWithTTL("k2", "v2", time.Second)
+	c.Get("k1")
+	now = now.Add(time.Minute)
+	if _, ok := c.Get("k2"); ok {
+		t.Fatalf("expired k2 should miss")
+	}
+	c.Add("k3", "v3") // 过期的 k2先被淘汰
+	c.Remove("k3")
+
+	expect := []lru.EvictReason{lru.EvictExpired, lru.EvictRemoved}
+	if !reflect.DeepEqual(expect, reasons) {
+		t.Fatalf("OnEvicted reasons = %v, want %v", reasons, expect)
+	}
+}
+
+// 多个 Get可以在读锁下并发调用
+func TestConcurrentGet(t *testing.T) {
+	var mu sync.RWMutex
+	c := NewCache[int, int](100, nil)
+	for i := 0; i < 100; i++ {
+		c.Add(i, i)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				mu.RLock()
+				if v, ok := c.Get(i % 100); !ok || v != i%100 {
+					t.Errorf("Get(%d) = %d, %v", i%100, v, ok)
+				}
+				mu.RUnlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// 没有容量限制、过期之后不再被访问的节点，由 Add顺带回收
+func TestSweepOnAdd(t *testing.T) {
+	now := time.Now()
+	c := NewCache[string, string](0, nil)
+	c.now = func() time.Time { return now }
+	for i := 0; i < 2*lru.SweepBatch; i++ {
+		c.AddWithTTL("k"+strconv.Itoa(i), "v", time.Second)
+	}
+	now = now.Add(2 * time.Second)
+	c.Add("fresh1", "v")
+	c.Add("fresh2", "v")
+	c.Add("fresh3", "v")
+	if c.Len() != 3 || c.Evictions() != 2*lru.SweepBatch {
+		t.Fatalf("Len = %d, Evictions = %d, want expired keys swept", c.Len(), c.Evictions())
+	}
+}
@@ -0,0 +1,254 @@
+// cachesim 用 key的访问记录（trace）回放各种淘汰算法，比较不同缓存大小下的命中率，
+// 帮忙选择 Group的 cacheBytes和 WithPolicy。
+//
+//	go run ./cmd/cachesim -trace P1.lis -format arc -sizes 16M,64M,256M
+//
+// 支持的 trace格式：
+//
+//	plain  每行一个 key，后面可以跟一个空格分隔的大小（字节），没有大小时用 -size
+//	arc    ARC论文的 trace，每行 "起始块号 块数 忽略 请求号"，每个块算一次访问
+//	lirs   LIRS论文的 trace，每行一个块号，"*"开头的行忽略
+//
+// arc和 lirs的每个块大小是 -block字节
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"module/arc"
+	"module/clock"
+	"module/lfu"
+	"module/lru"
+	"module/sieve"
+	"module/tinylfu"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// 一次访问
+type access struct {
+	key  string
+	size int64
+}
+
+// 回放时用到的缓存方法，值就是这个 key的大小
+type simCache interface {
+	Get(key string) (int64, bool)
+	Add(key string, size int64)
+	Evictions() int64
+}
+
+func entrySize(key string, size int64) int64 {
+	return size
+}
+
+// 所有淘汰算法，avgSize是 trace里的平均大小，用来估计 TinyLFU的 sketch大小
+var policies = []struct {
+	name string
+	new  func(maxBytes, avgSize int64) simCache
+}{
+	{"lru", func(maxBytes, _ int64) simCache { return lru.NewCache(maxBytes, entrySize) }},
+	{"lfu", func(maxBytes, _ int64) simCache { return lfu.NewCache(maxBytes, entrySize) }},
+	{"arc", func(maxBytes, _ int64) simCache { return arc.NewCache(maxBytes, entrySize) }},
+	{"tinylfu", func(maxBytes, avgSize int64) simCache {
+		return tinylfu.NewCache(maxBytes, int(maxBytes/avgSize), entrySize, tinylfu.StringHash)
+	}},
+	{"sieve", func(maxBytes, _ int64) simCache { return sieve.NewCache(maxBytes, entrySize) }},
+	{"clock", func(maxBytes, _ int64) simCache { return clock.NewCache(maxBytes, entrySize) }},
+}
+
+// 一次回放的结果
+type result struct {
+	policy    string
+	maxBytes  int64
+	hits      int64
+	hitBytes  int64
+	evictions int64
+}
+
+func replay(c simCache, trace []access) (hits, hitBytes int64) {
+	for _, a := range trace {
+		if _, ok := c.Get(a.key); ok {
+			hits++
+			hitBytes += a.size
+		} else {
+			c.Add(a.key, a.size)
+		}
+	}
+	return
+}
+
+// 读 trace文件
+func readTrace(r io.Reader, format string, defaultSize, blockSize int64) ([]access, error) {
+	var trace []access
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch format {
+		case "plain":
+			size := defaultSize
+			if len(fields) > 1 {
+				n, err := strconv.ParseInt(fields[1], 10, 64)
+				if err != nil || n <= 0 {
+					return nil, fmt.Errorf("line %d: bad size %q", line, fields[1])
+				}
+				size = n
+			}
+			trace = append(trace, access{fields[0], size})
+		case "arc":
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("line %d: want \"start count ...\"", line)
+			}
+			start, err1 := strconv.ParseInt(fields[0], 10, 64)
+			count, err2 := strconv.ParseInt(fields[1], 10, 64)
+			if err1 != nil || err2 != nil || count <= 0 {
+				return nil, fmt.Errorf("line %d: bad block range %q %q", line, fields[0], fields[1])
+			}
+			for b := start; b < start+count; b++ {
+				trace = append(trace, access{strconv.FormatInt(b, 10), blockSize})
+			}
+		case "lirs":
+			if strings.HasPrefix(fields[0], "*") {
+				continue
+			}
+			if _, err := strconv.ParseInt(fields[0], 10, 64); err != nil {
+				return nil, fmt.Errorf("line %d: bad block number %q", line, fields[0])
+			}
+			trace = append(trace, access{fields[0], blockSize})
+		default:
+			return nil, fmt.Errorf("unknown trace format %q", format)
+		}
+	}
+	return trace, scanner.Err()
+}
+
+// 解析 "64K,16M,1G"这样的大小列表
+func parseSizes(s string) ([]int64, error) {
+	var sizes []int64
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		unit := int64(1)
+		switch {
+		case strings.HasSuffix(f, "K"):
+			unit = 1 << 10
+		case strings.HasSuffix(f, "M"):
+			unit = 1 << 20
+		case strings.HasSuffix(f, "G"):
+			unit = 1 << 30
+		}
+		if unit != 1 {
+			f = f[:len(f)-1]
+		}
+		n, err := strconv.ParseInt(f, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("bad cache size %q", f)
+		}
+		sizes = append(sizes, n*unit)
+	}
+	return sizes, nil
+}
+
+func main() {
+	var (
+		tracePath = flag.String("trace", "", "trace file, - for stdin")
+		format    = flag.String("format", "plain", "trace format: plain, arc or lirs")
+		sizesFlag = flag.String("sizes", "1K,10K,100K", "comma separated cache sizes in bytes, K/M/G suffix allowed")
+		only      = flag.String("policies", "", "comma separated policies to run, default all")
+		output    = flag.String("output", "table", "output format: table or csv")
+		size      = flag.Int64("size", 1, "entry size for plain traces without a size column")
+		block     = flag.Int64("block", 512, "block size for arc and lirs traces")
+	)
+	flag.Parse()
+	if *tracePath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	sizes, err := parseSizes(*sizesFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	in := os.Stdin
+	if *tracePath != "-" {
+		if in, err = os.Open(*tracePath); err != nil {
+			log.Fatal(err)
+		}
+		defer in.Close()
+	}
+	trace, err := readTrace(in, *format, *size, *block)
+	if err != nil {
+		log.Fatalf("reading trace %s: %v", *tracePath, err)
+	}
+	if len(trace) == 0 {
+		log.Fatalf("trace %s is empty", *tracePath)
+	}
+	var totalBytes int64
+	for _, a := range trace {
+		totalBytes += a.size
+	}
+	avgSize := totalBytes / int64(len(trace))
+	if avgSize == 0 {
+		avgSize = 1
+	}
+
+	selected := make(map[string]bool)
+	if *only != "" {
+		for _, name := range strings.Split(*only, ",") {
+			selected[strings.TrimSpace(name)] = true
+		}
+	}
+	var results []result
+	for _, maxBytes := range sizes {
+		for _, p := range policies {
+			if len(selected) > 0 && !selected[p.name] {
+				continue
+			}
+			c := p.new(maxBytes, avgSize)
+			hits, hitBytes := replay(c, trace)
+			results = append(results, result{p.name, maxBytes, hits, hitBytes, c.Evictions()})
+		}
+	}
+	if len(results) == 0 {
+		log.Fatalf("no policy matches %q", *only)
+	}
+
+	header := []string{"policy", "max_bytes", "requests", "hit_ratio", "byte_hit_ratio", "evictions"}
+	rows := make([][]string, 0, len(results))
+	for _, r := range results {
+		rows = append(rows, []string{
+			r.policy,
+			strconv.FormatInt(r.maxBytes, 10),
+			strconv.Itoa(len(trace)),
+			fmt.Sprintf("%.4f", float64(r.hits)/float64(len(trace))),
+			fmt.Sprintf("%.4f", float64(r.hitBytes)/float64(totalBytes)),
+			strconv.FormatInt(r.evictions, 10),
+		})
+	}
+	switch *output {
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write(header)
+		w.WriteAll(rows)
+		if err := w.Error(); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.Join(header, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		w.Flush()
+	}
+}
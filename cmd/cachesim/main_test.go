@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadTrace(t *testing.T) {
+	for _, tt := range []struct {
+		format string
+		input  string
+		want   []access
+		err    string
+	}{
+		{"plain", "# comment\na\n\nb 100\n", []access{{"a", 7}, {"b", 100}}, ""},
+		{"plain", "a\nb 0\n", nil, "line 2: bad size"},
+		{"plain", "a x\n", nil, "line 1: bad size"},
+		{"arc", "10 3 0 0\n20 1\n", []access{{"10", 512}, {"11", 512}, {"12", 512}, {"20", 512}}, ""},
+		{"arc", "10\n", nil, "line 1: want"},
+		{"arc", "10 0\n", nil, "line 1: bad block range"},
+		{"arc", "x 1\n", nil, "line 1: bad block range"},
+		{"lirs", "1\n*\n2\n1\n", []access{{"1", 512}, {"2", 512}, {"1", 512}}, ""},
+		{"lirs", "1\nx\n", nil, "line 2: bad block number"},
+		{"zipf", "1\n", nil, "unknown trace format"},
+	} {
+		got, err := readTrace(strings.NewReader(tt.input), tt.format, 7, 512)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s %q: err = %v, want %q", tt.format, tt.input, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %q = %v, %v, want %v", tt.format, tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseSizes(t *testing.T) {
+	for _, tt := range []struct {
+		input string
+		want  []int64
+	}{
+		{"100", []int64{100}},
+		{"64K, 16M,1G", []int64{64 << 10, 16 << 20, 1 << 30}},
+		{"", nil},
+		{"K", nil},
+		{"10T", nil},
+		{"0", nil},
+		{"-1K", nil},
+		{"1K,,2K", nil},
+	} {
+		got, err := parseSizes(tt.input)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("parseSizes(%q) = %v, want error", tt.input, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSizes(%q) = %v, %v, want %v", tt.input, got, err, tt.want)
+		}
+	}
+}
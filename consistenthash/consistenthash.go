@@ -2,7 +2,6 @@ package consistenthash
 
 import (
 	"hash/crc32"
-	"log"
 	"sort"
 	"strconv"
 )
@@ -15,6 +14,9 @@ type Map struct {
 	replicas int            // 虚拟节点倍数
 	keys     []int          // 哈希环, 有序的, 存的是所有节点的 hashInt
 	hashMap  map[int]string // 虚拟节点哈希值与真实节点的映射表，k是虚拟节点哈希值，v是真实节点的名称
+	// 不同真实节点的虚拟节点哈希冲突时，名称最小的节点拿到这个位置，其他的记在这里，
+	// 拿到位置的节点删除之后由它们接替。这样哈希环和 Add的顺序无关
+	shadowed map[int][]string
 }
 
 // 可以自定义虚拟节点倍数和 Hash函数, 这里默认使用 crc32.ChecksumIEEE
@@ -23,6 +25,7 @@ func New(replicas int, fn Hash) *Map {
 		replicas: replicas,
 		hash:     fn,
 		hashMap:  make(map[int]string),
+		shadowed: make(map[int][]string),
 	}
 	if m.hash == nil {
 		m.hash = crc32.ChecksumIEEE
@@ -30,27 +33,124 @@ func New(replicas int, fn Hash) *Map {
 	return m
 }
 
-// 在哈希环上填充真实节点和虚拟节点
+// 在哈希环上填充真实节点和虚拟节点，已经在环上的节点忽略
 func (m *Map) Add(keys ...string) {
-	log.Println("consistenthash: keys: ", keys)
 	for _, key := range keys {
 		for i := 0; i < m.replicas; i++ { // 每个真实节点 key，创建 m.replicas个虚拟节点
 			// 这里是把 string -> []byte -> uint32 -> int
 			hashInt := int(m.hash([]byte(strconv.Itoa(i) + key))) // 虚拟节点名称：strconv.Itoa(i)+key  注意这是string拼接
-			m.keys = append(m.keys, hashInt)
-			m.hashMap[hashInt] = key // 关联虚拟节点哈希值和真实节点名称
+			owner, ok := m.hashMap[hashInt]
+			switch {
+			case !ok:
+				m.keys = append(m.keys, hashInt)
+				m.hashMap[hashInt] = key // 关联虚拟节点哈希值和真实节点名称
+			case owner == key || contains(m.shadowed[hashInt], key):
+			case key < owner: // 哈希冲突，名称小的节点拿到这个位置
+				m.hashMap[hashInt] = key
+				m.shadowed[hashInt] = append(m.shadowed[hashInt], owner)
+			default:
+				m.shadowed[hashInt] = append(m.shadowed[hashInt], key)
+			}
 		}
 	}
 	sort.Ints(m.keys) // int数组排序
 	// m.hashMap[hashInt] = key (key就是真实url)
 }
 
+// 从哈希环上删除真实节点和它的虚拟节点，不存在的节点忽略
+func (m *Map) Remove(keys ...string) {
+	removed := make(map[int]bool)
+	for _, key := range keys {
+		for i := 0; i < m.replicas; i++ {
+			hashInt := int(m.hash([]byte(strconv.Itoa(i) + key)))
+			others := m.shadowed[hashInt]
+			if m.hashMap[hashInt] != key { // 和别的节点的虚拟节点哈希冲突时，这个位置不属于 key
+				m.setShadowed(hashInt, remove(others, key))
+				continue
+			}
+			if len(others) == 0 {
+				delete(m.hashMap, hashInt)
+				removed[hashInt] = true
+				continue
+			}
+			next := others[0] // 名称最小的接替
+			for _, other := range others[1:] {
+				if other < next {
+					next = other
+				}
+			}
+			m.hashMap[hashInt] = next
+			m.setShadowed(hashInt, remove(others, next))
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	kept := m.keys[:0]
+	for _, hashInt := range m.keys {
+		if !removed[hashInt] {
+			kept = append(kept, hashInt)
+		}
+	}
+	m.keys = kept
+}
+
+func (m *Map) setShadowed(hashInt int, keys []string) {
+	if len(keys) == 0 {
+		delete(m.shadowed, hashInt)
+		return
+	}
+	m.shadowed[hashInt] = keys
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// 去掉 key之后剩下的节点
+func remove(keys []string, key string) []string {
+	var kept []string
+	for _, k := range keys {
+		if k != key {
+			kept = append(kept, k)
+		}
+	}
+	return kept
+}
+
+// 复制一份哈希环，修改之前保存下来，可以和修改之后的比较
+func (m *Map) Clone() *Map {
+	c := &Map{
+		hash:     m.hash,
+		replicas: m.replicas,
+		keys:     append([]int(nil), m.keys...),
+		hashMap:  make(map[int]string, len(m.hashMap)),
+		shadowed: make(map[int][]string, len(m.shadowed)),
+	}
+	for k, v := range m.hashMap {
+		c.hashMap[k] = v
+	}
+	for k, v := range m.shadowed {
+		c.shadowed[k] = append([]string(nil), v...)
+	}
+	return c
+}
+
 // 得到真实的节点名称
 func (m *Map) Get(key string) string {
+	return m.owner(int(m.hash([]byte(key)))) // key的 hash值，映射在哈希环上
+}
+
+// 哈希值 hashInt归哪个真实节点负责，环是空的时候返回 ""
+func (m *Map) owner(hashInt int) string {
 	if len(m.keys) == 0 {
 		return ""
 	}
-	hashInt := int(m.hash([]byte(key))) // key的 hash值，映射在哈希环上
 	// 通过顺时针查找最近的一个虚拟节点的下标。
 	// 是第一个比给定 hash值大的节点
 	idx := sort.Search(len(m.keys), func(i int) bool {
@@ -58,3 +158,45 @@ func (m *Map) Get(key string) string {
 	})
 	return m.hashMap[m.keys[idx%len(m.keys)]]
 }
+
+// 哈希环上的一段 (Start, End]，负责的节点从 From变成了 To，
+// Start >= End 表示这一段跨过了 0。From或者 To为 "" 表示那时候环是空的
+type Range struct {
+	Start, End uint32
+	From, To   string
+}
+
+// 比较同一个哈希函数的两个环，返回负责的节点发生变化的范围，按 Start排序。
+// old为 nil当作空的环
+func Changes(old, m *Map) []Range {
+	if old == nil {
+		old = &Map{}
+	}
+	// 两个环的所有虚拟节点把环分成很多段，每一段在两个环里各自只属于一个节点
+	var points []int
+	points = append(points, old.keys...)
+	points = append(points, m.keys...)
+	sort.Ints(points)
+	uniq := points[:0]
+	for _, p := range points {
+		if len(uniq) == 0 || p != uniq[len(uniq)-1] {
+			uniq = append(uniq, p)
+		}
+	}
+	points = uniq
+
+	var changes []Range
+	for i, end := range points {
+		start := points[(i+len(points)-1)%len(points)] // 第一段从最后一个点开始，跨过 0
+		from, to := old.owner(end), m.owner(end)
+		if from == to {
+			continue
+		}
+		if n := len(changes); n > 0 && changes[n-1].End == uint32(start) && changes[n-1].From == from && changes[n-1].To == to {
+			changes[n-1].End = uint32(end) // 和上一段连在一起
+			continue
+		}
+		changes = append(changes, Range{Start: uint32(start), End: uint32(end), From: from, To: to})
+	}
+	return changes
+}
@@ -0,0 +1,108 @@
+package consistenthash
+
+import (
+	"strconv"
+	"testing"
+)
+
+// 用数字字符串本身作为哈希值，方便算出每个 key归谁
+func newTestMap() *Map {
+	return New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+}
+
+func TestHashing(t *testing.T) {
+	m := newTestMap()
+	m.Add("6", "4", "2") // 虚拟节点 2, 4, 6, 12, 14, 16, 22, 24, 26
+
+	for key, owner := range map[string]string{"2": "2", "11": "2", "23": "4", "27": "2"} {
+		if got := m.Get(key); got != owner {
+			t.Fatalf("Get(%s) = %s, want %s", key, got, owner)
+		}
+	}
+	m.Add("8") // 8, 18, 28
+	if got := m.Get("27"); got != "8" {
+		t.Fatalf("Get(27) = %s, want 8", got)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	m := newTestMap()
+	m.Add("6", "4", "2")
+	m.Remove("4", "9") // 9不存在，忽略
+	if len(m.keys) != 6 || len(m.hashMap) != 6 {
+		t.Fatalf("ring has %d keys, %d nodes after Remove, want 6", len(m.keys), len(m.hashMap))
+	}
+	if got := m.Get("23"); got != "6" {
+		t.Fatalf("Get(23) = %s, want 6 after removing 4", got)
+	}
+	m.Remove("6", "2")
+	if got := m.Get("23"); got != "" {
+		t.Fatalf("Get on empty ring = %q", got)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	m := newTestMap()
+	m.Add("6", "4", "2")
+	old := m.Clone()
+	m.Remove("4")
+
+	// 4的三段 (2, 4], (12, 14], (22, 24] 都交给了 6
+	expect := []Range{{2, 4, "4", "6"}, {12, 14, "4", "6"}, {22, 24, "4", "6"}}
+	changes := Changes(old, m)
+	if len(changes) != len(expect) {
+		t.Fatalf("Changes = %v, want %v", changes, expect)
+	}
+	for i := range expect {
+		if changes[i] != expect[i] {
+			t.Fatalf("Changes = %v, want %v", changes, expect)
+		}
+	}
+	if old.Get("23") != "4" {
+		t.Fatalf("Clone should not be affected by Remove")
+	}
+	if n := len(Changes(m, m)); n != 0 {
+		t.Fatalf("same ring should have no changes, got %d", n)
+	}
+}
+
+// "a"和 "b"的虚拟节点 1a、1b哈希冲突，不管 Add的顺序，名称小的 a拿到这个位置，
+// 删掉其中一个之后，另一个还在这个位置上
+func TestCollision(t *testing.T) {
+	hash := func(key []byte) uint32 {
+		switch string(key) {
+		case "0a":
+			return 10
+		case "0b":
+			return 20
+		case "1a", "1b":
+			return 30
+		}
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	}
+	for _, order := range [][]string{{"a", "b"}, {"b", "a"}} {
+		m := New(2, hash)
+		m.Add(order...)
+		m.Add(order[0]) // 已经在环上，忽略
+		if len(m.keys) != 3 || m.Get("25") != "a" {
+			t.Fatalf("Add(%v): keys = %v, Get(25) = %s, want 3 keys owned by a", order, m.keys, m.Get("25"))
+		}
+		c := m.Clone()
+		m.Remove("a")
+		if len(m.keys) != 2 || m.Get("25") != "b" || m.Get("5") != "b" {
+			t.Fatalf("after Remove(a): keys = %v, Get(25) = %s, want b", m.keys, m.Get("25"))
+		}
+		if c.Get("25") != "a" {
+			t.Fatalf("Remove changed the clone")
+		}
+		m.Add("a")
+		m.Remove("b")
+		if len(m.keys) != 2 || m.Get("25") != "a" || m.Get("15") != "a" {
+			t.Fatalf("after Remove(b): keys = %v, Get(25) = %s, want a", m.keys, m.Get("25"))
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 批量请求最多包含的 key个数
+const maxBatchKeys = 1000
+
+// 批量请求 body的最大字节数，maxBatchKeys个 key平均每个可以有 1K
+const maxBatchBody = maxBatchKeys << 10
+
+// 没有 BatchGetter时，GetMulti同时调用 Getter的最大个数
+const maxBatchLoads = 16
+
+// 批量从数据源获取，NewGroup传入的 Getter如果也实现了 BatchGetter，
+// GetMulti中由本节点负责的 key会一次性交给它。返回的 map里没有的 key当作不存在
+type BatchGetter interface {
+	GetMulti(ctx context.Context, keys []string) (map[string][]byte, error)
+}
+
+// GetMulti中获取失败的 key和对应的错误
+type BatchError map[string]error
+
+func (e BatchError) Error() string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	msgs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", key, e[key]))
+	}
+	return fmt.Sprintf("geecache: %d keys failed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// 批量获取多个 key
+func (g *Group) GetMulti(keys []string) (map[string]ByteView, error) {
+	return g.GetMultiContext(context.Background(), keys)
+}
+
+// 批量获取多个 key，返回获取成功的值。
+// 本地缓存命中的直接返回；剩下的按 PickPeer选出的节点分组，每个节点只发一次请求；
+// 本节点负责的 key（以及远程节点获取失败的 key）交给 BatchGetter，或者并发地逐个加载。
+// 和 Get共用 singleflight，正在加载的 key不会重复加载。
+// 有 key获取失败时，返回的 error是 BatchError
+func (g *Group) GetMultiContext(ctx context.Context, keys []string) (map[string]ByteView, error) {
+	values := make(map[string]ByteView, len(keys))
+	errs := make(BatchError)
+
+	seen := make(map[string]bool, len(keys))
+	var missing []string
+	for _, key := range keys {
+		if seen[key] { // 重复的 key只查一次
+			continue
+		}
+		seen[key] = true
+		g.stats.gets.Add(1)
+		if key == "" {
+			errs[key] = ErrEmptyKey
+			continue
+		}
+		if v, ok := g.lookupCache(key); ok {
+			values[key] = v
+			continue
+		}
+		if err := g.lookupNegative(key); err != nil {
+			errs[key] = err
+			continue
+		}
+		missing = append(missing, key)
+	}
+
+	// 按所属节点分组，本节点负责的 key放在 nil下面
+	type peerKeys struct {
+		peer PeerGetter
+		keys []string
+	}
+	byPeer := make(map[interface{}]*peerKeys)
+	for _, key := range missing {
+		var peer PeerGetter
+		if g.peers != nil {
+			if p, ok := g.peers.PickPeer(key); ok {
+				peer = p
+			}
+		}
+		id := peerID(peer)
+		if byPeer[id] == nil {
+			byPeer[id] = &peerKeys{peer: peer}
+		}
+		byPeer[id].keys = append(byPeer[id].keys, key)
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex // 保护 values和 errs
+	)
+	for _, pk := range byPeer {
+		wg.Add(1)
+		go func(peer PeerGetter, peerKeys []string) {
+			defer wg.Done()
+			vals, loadErrs, shared := g.loader.DoMulti(ctx, peerKeys, func(ctx context.Context, keys []string) (map[string]interface{}, map[string]error) {
+				return g.loadMulti(ctx, peer, keys)
+			})
+			g.stats.loadsDeduped.Add(int64(shared))
+			mu.Lock()
+			defer mu.Unlock()
+			for key, v := range vals {
+				values[key] = v.(ByteView)
+			}
+			for key, err := range loadErrs {
+				errs[key] = err
+			}
+		}(pk.peer, pk.keys)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return values, errs
+	}
+	return values, nil
+}
+
+// GetMulti分组用的 map key。PeerGetter可能是函数这样不能比较的类型，直接当 map的 key会 panic，
+// 这时候没法判断两次 PickPeer是不是同一个节点，每个 key单独一组
+func peerID(peer PeerGetter) interface{} {
+	if peer == nil || reflect.TypeOf(peer).Comparable() {
+		return peer
+	}
+	return new(int)
+}
+
+// 批量版本的 loadFunc，在 singleflight里执行：先请求 key所属的远程节点，
+// 失败的 key再从数据源获取。peer为 nil表示这些 key由本节点负责
+func (g *Group) loadMulti(ctx context.Context, peer PeerGetter, keys []string) (map[string]interface{}, map[string]error) {
+	values := make(map[string]ByteView, len(keys))
+	errs := make(BatchError)
+	local := keys
+	if peer != nil {
+		local = nil
+		got, notFound := g.getMultiFromPeer(ctx, peer, keys)
+		for _, key := range keys {
+			if v, ok := got[key]; ok {
+				values[key] = v
+			} else if err, ok := notFound[key]; ok {
+				errs[key] = err // 所属节点确认数据源里没有
+				g.addNegative(key)
+			} else {
+				local = append(local, key) // 和 loadFunc一样，远程节点失败后回退到本地加载
+			}
+		}
+	}
+	g.getMultiLocally(ctx, local, values, errs)
+
+	result := make(map[string]interface{}, len(values))
+	for key, v := range values {
+		result[key] = v
+	}
+	return result, errs
+}
+
+// 从一个远程节点获取多个 key，节点不支持批量请求时逐个获取。
+// notFound是远程节点确认数据源里没有的 key
+func (g *Group) getMultiFromPeer(ctx context.Context, peer PeerGetter, keys []string) (values map[string]ByteView, notFound BatchError) {
+	values = make(map[string]ByteView, len(keys))
+	notFound = make(BatchError)
+	bp, ok := peer.(BatchPeerGetter)
+	if !ok {
+		for _, key := range keys {
+			v, err := g.getFromPeer(ctx, peer, key)
+			switch {
+			case err == nil:
+				g.stats.peerLoads.Add(1)
+				values[key] = v
+			case errors.Is(err, ErrNotFound):
+				notFound[key] = err
+			default:
+				g.stats.peerErrors.Add(1)
+			}
+		}
+		return values, notFound
+	}
+
+	got, err := bp.GetMulti(ctx, g.name, keys)
+	if errs, ok := err.(BatchError); ok {
+		for key, e := range errs {
+			if errors.Is(e, ErrNotFound) {
+				notFound[key] = e
+			}
+		}
+	} else if err != nil {
+		g.stats.peerErrors.Add(int64(len(keys)))
+		g.logger.Errorf("[GetCache] Failed to get %d keys from peer: %v", len(keys), err)
+		return values, notFound
+	}
+	for _, key := range keys {
+		bytes, ok := got[key]
+		if !ok {
+			if _, ok := notFound[key]; !ok {
+				g.stats.peerErrors.Add(1)
+			}
+			continue
+		}
+		g.stats.peerLoads.Add(1)
+		value := ByteView{b: bytes}
+		g.maybeAddHot(key, value)
+		values[key] = value
+	}
+	return values, notFound
+}
+
+// 从数据源获取多个 key，结果写入 values，失败的写入 errs
+func (g *Group) getMultiLocally(ctx context.Context, keys []string, values map[string]ByteView, errs BatchError) {
+	if len(keys) == 0 {
+		return
+	}
+	bg, ok := g.getter.(BatchGetter)
+	if !ok {
+		// 已经在 singleflight里了，直接调用 getLocally，最多同时加载 maxBatchLoads个
+		var (
+			wg  sync.WaitGroup
+			mu  sync.Mutex
+			sem = make(chan struct{}, maxBatchLoads)
+		)
+		for _, key := range keys {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(key string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				v, err := g.getLocally(ctx, key)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					errs[key] = err
+				} else {
+					values[key] = v
+				}
+			}(key)
+		}
+		wg.Wait()
+		return
+	}
+
+	got, err := bg.GetMulti(ctx, keys)
+	if err != nil {
+		g.stats.getterErrors.Add(int64(len(keys)))
+		for _, key := range keys {
+			errs[key] = err
+		}
+		return
+	}
+	for _, key := range keys {
+		bytes, ok := got[key]
+		if !ok {
+			g.stats.getterErrors.Add(1)
+			errs[key] = fmt.Errorf("%w: %s", ErrNotFound, key)
+			g.addNegative(key)
+			continue
+		}
+		g.stats.getterLoads.Add(1)
+		value := ByteView{b: cloneBytes(bytes), e: g.expireAt()}
+		g.populateCache(key, value)
+		values[key] = value
+	}
+}
+
+// -------------------- 下面是批量请求的 http协议
+// POST basePath/groupname，body是 JSON格式的 key数组，
+// 返回 JSON格式的 batchResponse。[]byte在 JSON里是 base64编码的
+
+type batchResponse struct {
+	Values   map[string][]byte `json:"values"`
+	NotFound []string          `json:"not_found,omitempty"` // 数据源里没有的 key
+	Errors   map[string]string `json:"errors,omitempty"`
+}
+
+// 处理其他节点发来的批量请求
+func (p *HTTPPool) serveBatch(w http.ResponseWriter, r *http.Request, group *Group) {
+	var keys []string
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBody)).Decode(&keys); err != nil {
+		writeError(w, fmt.Errorf("%w: %v", ErrBadRequest, err))
+		return
+	}
+	if len(keys) > maxBatchKeys {
+		writeError(w, fmt.Errorf("%w: too many keys: %d > %d", ErrBadRequest, len(keys), maxBatchKeys))
+		return
+	}
+
+	values, err := group.GetMultiContext(r.Context(), keys)
+	resp := batchResponse{Values: make(map[string][]byte, len(values))}
+	for key, v := range values {
+		resp.Values[key] = v.b
+	}
+	if errs, ok := err.(BatchError); ok {
+		resp.Errors = make(map[string]string, len(errs))
+		for key, e := range errs {
+			if errors.Is(e, ErrNotFound) {
+				resp.NotFound = append(resp.NotFound, key)
+			} else {
+				resp.Errors[key] = e.Error()
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// 一次请求获取远程节点上的多个 key，实现 BatchPeerGetter接口。
+// 远程节点确认不存在的 key，在返回的 BatchError里对应 ErrNotFound
+func (h *httpGetter) GetMulti(ctx context.Context, groupName string, keys []string) (_ map[string][]byte, err error) {
+	if err := h.breaker.allow(); err != nil {
+		return nil, err
+	}
+	defer func() { h.breaker.done(err) }()
+	body, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	u := h.baseURL + url.QueryEscape(groupName)
+	h.logger.Debugf("httpGetter | GetMulti %d keys from url: %v", len(keys), u)
+	ctx, cancel := h.requestContext(ctx)
+	defer cancel()
+	req, err := h.newRequest(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	start := time.Now()
+	defer func() { h.latency.observe(time.Since(start)) }()
+	res, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, readPeerError(res)
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %v", err)
+	}
+	var resp batchResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("decoding batch response: %v", err)
+	}
+	for key, msg := range resp.Errors {
+		h.logger.Debugf("httpGetter | GetMulti %v: %v", key, msg)
+	}
+	if len(resp.NotFound) > 0 {
+		errs := make(BatchError, len(resp.NotFound))
+		for _, key := range resp.NotFound {
+			errs[key] = ErrNotFound
+		}
+		return resp.Values, errs
+	}
+	return resp.Values, nil
+}
+
+var _ BatchPeerGetter = (*httpGetter)(nil)
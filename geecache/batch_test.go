@@ -0,0 +1,205 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 没有 BatchGetter时，本地加载是并发的，每个 key只加载一次
+func TestGetMultiLocal(t *testing.T) {
+	var loads atomic.Int64
+	g := NewGroup("batch-local", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		if key == "missing" {
+			return nil, ErrNotFound
+		}
+		return []byte("v-" + key), nil
+	}))
+
+	keys := []string{"missing", "", "missing"}
+	for i := 0; i < 32; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	start := time.Now()
+	values, err := g.GetMulti(keys)
+	if d := time.Since(start); d > 320*time.Millisecond {
+		t.Fatalf("GetMulti took %v, local loads are not concurrent", d)
+	}
+	var be BatchError
+	if !errors.As(err, &be) || len(be) != 2 || !errors.Is(be["missing"], ErrNotFound) || !errors.Is(be[""], ErrEmptyKey) {
+		t.Fatalf("err = %v, want missing and empty key", err)
+	}
+	if len(values) != 32 || values["7"].String() != "v-7" {
+		t.Fatalf("GetMulti returned %d values, v-7 = %q", len(values), values["7"].String())
+	}
+	if n := loads.Load(); n != 33 {
+		t.Fatalf("getter called %d times, want 33", n)
+	}
+
+	if _, err := g.GetMulti([]string{"1", "2"}); err != nil || loads.Load() != 33 {
+		t.Fatalf("cached keys loaded again: %v, %d loads", err, loads.Load())
+	}
+}
+
+// 正在被 Get加载的 key，GetMulti等它的结果，不重复加载
+func TestGetMultiDedup(t *testing.T) {
+	var loads atomic.Int64
+	release := make(chan struct{})
+	g := NewGroup("batch-dedup", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		if key == "slow" {
+			<-release
+		}
+		return []byte("v-" + key), nil
+	}))
+	go g.Get("slow")
+	for g.loader.InFlight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+	values, err := g.GetMulti([]string{"slow", "fast"})
+	if err != nil || values["slow"].String() != "v-slow" || values["fast"].String() != "v-fast" {
+		t.Fatalf("GetMulti = %v, %v", values, err)
+	}
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("getter called %d times, want 2", n)
+	}
+	if n := g.Stats().LoadsDeduped; n != 1 {
+		t.Fatalf("LoadsDeduped = %d, want 1", n)
+	}
+}
+
+type fakeBatchPeer struct {
+	mu    sync.Mutex
+	calls [][]string
+}
+
+func (p *fakeBatchPeer) Get(group string, key string) ([]byte, error) {
+	return nil, errors.New("unexpected single Get")
+}
+
+// "pgone"不存在，"pflaky"获取失败，其他的返回 peer-key
+func (p *fakeBatchPeer) GetMulti(ctx context.Context, group string, keys []string) (map[string][]byte, error) {
+	p.mu.Lock()
+	p.calls = append(p.calls, keys)
+	p.mu.Unlock()
+	values := make(map[string][]byte)
+	errs := make(BatchError)
+	for _, key := range keys {
+		switch key {
+		case "pgone":
+			errs[key] = ErrNotFound
+		case "pflaky":
+		default:
+			values[key] = []byte("peer-" + key)
+		}
+	}
+	return values, errs
+}
+
+type fakePicker struct {
+	peer PeerGetter
+}
+
+// 以 p开头的 key属于远程节点
+func (f fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	if key != "" && key[0] == 'p' {
+		return f.peer, true
+	}
+	return nil, false
+}
+
+func TestGetMultiPeers(t *testing.T) {
+	peer := &fakeBatchPeer{}
+	g := NewGroup("batch-peers", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		if key == "pgone" {
+			t.Errorf("key confirmed missing by the peer loaded locally")
+		}
+		return []byte("local-" + key), nil
+	}))
+	g.RegisterPeers(fakePicker{peer})
+
+	values, err := g.GetMulti([]string{"p1", "p2", "pgone", "pflaky", "l1"})
+	if len(peer.calls) != 1 || len(peer.calls[0]) != 4 {
+		t.Fatalf("peer calls = %v, want one batch of 4 keys", peer.calls)
+	}
+	want := map[string]string{"p1": "peer-p1", "p2": "peer-p2", "pflaky": "local-pflaky", "l1": "local-l1"}
+	for key, v := range want {
+		if values[key].String() != v {
+			t.Errorf("values[%s] = %q, want %q", key, values[key].String(), v)
+		}
+	}
+	var be BatchError
+	if !errors.As(err, &be) || len(be) != 1 || !errors.Is(be["pgone"], ErrNotFound) {
+		t.Fatalf("err = %v, want pgone not found", err)
+	}
+}
+
+// 函数类型的 PeerGetter不能当 map的 key，GetMulti不能因此 panic
+type peerFunc func(group string, key string) ([]byte, error)
+
+func (f peerFunc) Get(group string, key string) ([]byte, error) {
+	return f(group, key)
+}
+
+func TestGetMultiFuncPeer(t *testing.T) {
+	g := NewGroup("batch-func-peer", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local-" + key), nil
+	}))
+	g.RegisterPeers(fakePicker{peerFunc(func(group string, key string) ([]byte, error) {
+		return []byte("peer-" + key), nil
+	})})
+	values, err := g.GetMulti([]string{"p1", "p2", "l1"})
+	if err != nil || values["p1"].String() != "peer-p1" || values["p2"].String() != "peer-p2" || values["l1"].String() != "local-l1" {
+		t.Fatalf("GetMulti = %v, %v", values, err)
+	}
+}
+
+func TestServeBatch(t *testing.T) {
+	NewGroup("batch-serve", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, ErrNotFound
+		}
+		return []byte("v-" + key), nil
+	}))
+	srv := httptest.NewServer(NewHTTPPool("http://peer"))
+	defer srv.Close()
+	p := NewHTTPPool("http://self")
+	p.Set(srv.URL)
+	getter := p.httpGetters[srv.URL]
+
+	values, err := getter.GetMulti(context.Background(), "batch-serve", []string{"a", "missing", "b"})
+	var be BatchError
+	if !errors.As(err, &be) || len(be) != 1 || !errors.Is(be["missing"], ErrNotFound) {
+		t.Fatalf("err = %v, want missing not found", err)
+	}
+	if len(values) != 2 || string(values["a"]) != "v-a" || string(values["b"]) != "v-b" {
+		t.Fatalf("values = %q", values)
+	}
+
+	if _, err := getter.GetMulti(context.Background(), "no-such-group", []string{"a"}); !errors.Is(err, ErrNoSuchGroup) {
+		t.Fatalf("err = %v, want ErrNoSuchGroup", err)
+	}
+	tooMany := make([]string, maxBatchKeys+1)
+	for i := range tooMany {
+		tooMany[i] = strconv.Itoa(i)
+	}
+	if _, err := getter.GetMulti(context.Background(), "batch-serve", tooMany); !errors.Is(err, ErrBadRequest) {
+		t.Fatalf("err = %v, want ErrBadRequest", err)
+	}
+	// body太大，不等读完就拒绝
+	if _, err := getter.GetMulti(context.Background(), "batch-serve", []string{strings.Repeat("k", maxBatchBody)}); !errors.Is(err, ErrBadRequest) {
+		t.Fatalf("err = %v, want ErrBadRequest for an oversized body", err)
+	}
+}
@@ -0,0 +1,159 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 熔断器打开时，请求不发给远程节点，直接返回这个错误，Group会马上改为本地加载
+var ErrBreakerOpen = errors.New("geecache: peer circuit breaker is open")
+
+const (
+	defaultBreakerFailures = 5
+	defaultBreakerCooldown = 10 * time.Second
+)
+
+// 熔断器的状态
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 正常请求
+	BreakerOpen                         // 连续失败太多次，暂时不请求这个节点
+	BreakerHalfOpen                     // 冷却时间过了，放一个试探请求过去
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// JSON里输出成字符串
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// 每个远程节点一个熔断器的配置，零值字段使用默认值。
+// 连续失败 FailThreshold次后打开，Cooldown之后进入半开，
+// 半开时只放一个请求过去，成功就关闭，失败就重新打开
+type BreakerPolicy struct {
+	FailThreshold int
+	Cooldown      time.Duration
+	// 状态变化时的回调，peer是节点地址。在发起请求的 goroutine里调用，不能阻塞
+	OnStateChange func(peer string, from, to BreakerState)
+}
+
+type breaker struct {
+	policy BreakerPolicy
+	peer   string
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int       // closed状态下连续失败的次数
+	openedAt time.Time // 上一次打开的时间
+	probing  bool      // 半开状态下是否已经有试探请求
+	now      func() time.Time
+}
+
+func newBreaker(peer string, policy BreakerPolicy) *breaker {
+	if policy.FailThreshold <= 0 {
+		policy.FailThreshold = defaultBreakerFailures
+	}
+	if policy.Cooldown <= 0 {
+		policy.Cooldown = defaultBreakerCooldown
+	}
+	return &breaker{policy: policy, peer: peer, now: time.Now}
+}
+
+// 能否发起请求，可以的话请求结束后要调用 done。
+// b为 nil表示没有熔断器，总是可以
+func (b *breaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	from := b.state
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.policy.Cooldown {
+			b.mu.Unlock()
+			return ErrBreakerOpen
+		}
+		b.state, b.probing = BreakerHalfOpen, true
+	case BreakerHalfOpen:
+		if b.probing {
+			b.mu.Unlock()
+			return ErrBreakerOpen
+		}
+		b.probing = true
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+	return nil
+}
+
+// 记录请求的结果。调用方自己取消的请求不知道节点好不好，
+// 状态和失败次数都不变，只是让出试探的机会
+func (b *breaker) done(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	if errors.Is(err, context.Canceled) {
+		b.probing = false
+		b.mu.Unlock()
+		return
+	}
+	from := b.state
+	if !breakerFailure(err) {
+		b.state, b.failures, b.probing = BreakerClosed, 0, false
+	} else {
+		b.failures++
+		if b.state == BreakerHalfOpen || b.failures >= b.policy.FailThreshold {
+			b.state, b.openedAt, b.probing = BreakerOpen, b.now(), false
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+}
+
+func (b *breaker) notify(from, to BreakerState) {
+	if from != to && b.policy.OnStateChange != nil {
+		b.policy.OnStateChange(b.peer, from, to)
+	}
+}
+
+func (b *breaker) State() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// 哪些错误说明节点不正常。远程节点正常返回的错误（key不存在、请求不对）不算
+func breakerFailure(err error) bool {
+	if err == nil || errors.Is(err, errNotWire) {
+		return false
+	}
+	if _, ok := err.(BatchError); ok { // 批量请求里有 key不存在
+		return false
+	}
+	var pe *PeerError
+	if errors.As(err, &pe) {
+		return pe.Status >= 500
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	var changes []string
+	now := time.Now()
+	b := newBreaker("peer", BreakerPolicy{
+		FailThreshold: 2,
+		Cooldown:      time.Second,
+		OnStateChange: func(peer string, from, to BreakerState) {
+			changes = append(changes, fmt.Sprintf("%s %v->%v", peer, from, to))
+		},
+	})
+	b.now = func() time.Time { return now }
+	fail := errors.New("connection refused")
+
+	notFound := &PeerError{Status: http.StatusNotFound, Code: codeNotFound}
+	for _, err := range []error{fail, notFound, fail, fail} { // key不存在不算失败
+		if b.allow() != nil {
+			t.Fatalf("closed breaker should allow requests")
+		}
+		b.done(err)
+	}
+	if b.allow() != ErrBreakerOpen {
+		t.Fatalf("breaker should be open after 2 consecutive failures")
+	}
+
+	now = now.Add(time.Second)
+	if b.allow() != nil {
+		t.Fatalf("breaker should allow one probe after cooldown")
+	}
+	if b.allow() != ErrBreakerOpen {
+		t.Fatalf("half-open breaker should allow only one probe")
+	}
+	b.done(fail) // 试探失败，重新打开
+
+	now = now.Add(time.Second)
+	b.allow()
+	b.done(nil)
+	if b.State() != BreakerClosed {
+		t.Fatalf("successful probe should close the breaker")
+	}
+
+	expect := []string{
+		"peer closed->open",
+		"peer open->half-open", "peer half-open->open",
+		"peer open->half-open", "peer half-open->closed",
+	}
+	if !reflect.DeepEqual(expect, changes) {
+		t.Fatalf("state changes = %v, want %v", changes, expect)
+	}
+}
+
+// 调用方取消的请求不影响熔断器的状态
+func TestBreakerCanceled(t *testing.T) {
+	now := time.Now()
+	b := newBreaker("peer", BreakerPolicy{FailThreshold: 2, Cooldown: time.Second})
+	b.now = func() time.Time { return now }
+	fail := errors.New("connection refused")
+
+	b.allow()
+	b.done(fail)
+	b.allow()
+	b.done(context.Canceled) // 不能把失败次数清零
+	b.allow()
+	b.done(fail)
+	if b.State() != BreakerOpen {
+		t.Fatalf("canceled request reset the failure count")
+	}
+
+	now = now.Add(time.Second)
+	if b.allow() != nil {
+		t.Fatalf("breaker should allow one probe after cooldown")
+	}
+	b.done(fmt.Errorf("get: %w", context.Canceled)) // 试探被取消，不能关闭熔断器
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("canceled probe changed state to %v, want half-open", b.State())
+	}
+	if b.allow() != nil {
+		t.Fatalf("breaker should allow a new probe after the canceled one")
+	}
+	b.done(nil)
+	if b.State() != BreakerClosed {
+		t.Fatalf("successful probe should close the breaker")
+	}
+}
+
+// 熔断器打开后，请求不再发给远程节点
+func TestHTTPGetterBreaker(t *testing.T) {
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	p := NewHTTPPool("http://self")
+	p.SetBreaker(BreakerPolicy{FailThreshold: 3, Cooldown: time.Hour})
+	p.Set(srv.URL)
+	getter := p.httpGetters[srv.URL]
+	for i := 0; i < 10; i++ {
+		getter.getView(context.Background(), "scores", "Tom")
+	}
+	if n := requests.Load(); n != 3 {
+		t.Fatalf("peer got %d requests, want 3", n)
+	}
+	if _, err := getter.getView(context.Background(), "scores", "Tom"); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("err = %v, want ErrBreakerOpen", err)
+	}
+	if st := p.PeerStates(); st[0].Breaker != BreakerOpen {
+		t.Fatalf("PeerStates breaker = %v, want open", st[0].Breaker)
+	}
+}
@@ -1,8 +1,11 @@
 package geecache
 
+import "time"
+
 // 只读的数据结构，存储真实的缓存值
 type ByteView struct {
 	b []byte
+	e time.Time // 过期时间，零值表示永不过期
 }
 
 // 被缓存对象必须实现Value()接口，也就是Len()方法
@@ -20,6 +23,11 @@ func cloneBytes(b []byte) []byte {
 	return c
 }
 
+// 过期时间，零值表示永不过期
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
 func (v ByteView) String() string {
 	return string(v.b)
 }
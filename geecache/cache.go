@@ -1,25 +1,72 @@
 package geecache
 
 import (
-	"module/lru"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// Group内部使用的并发安全的缓存，cache和 shardedCache都实现了这个接口
+type cacher interface {
+	get(key string) (ByteView, bool)
+	add(key string, value ByteView)
+	remove(key string)
+	stats() CacheStats
+}
+
+// 根据分片个数和淘汰算法创建 mainCache
+func newMainCache(cacheBytes int64, shards int, grace time.Duration, policy Policy) cacher {
+	if shards > 1 {
+		return newShardedCache(cacheBytes, shards, grace, policy)
+	}
+	return &cache{cacheBytes: cacheBytes, grace: grace, policy: policy}
+}
+
 type cache struct {
-	mu         sync.Mutex
-	lru        *lru.Cache
-	cacheBytes int64 // 最大内存
+	mu         sync.RWMutex
+	ev         evictor
+	overhead   int64         // 每个值的节点开销，和 ev一起初始化
+	policy     Policy        // 淘汰算法，零值是 LRU
+	cacheBytes int64         // 最大内存
+	grace      time.Duration // 过期之后还在缓存里保留多久，用于 stale-while-revalidate
+
+	// 下面的统计值在持有 mu时更新，读的时候不需要加锁，不会阻塞 get/add
+	nbytes atomic.Int64 // key和值的长度
+	nheap  atomic.Int64 // 估计的堆内存，包括每个值的节点开销
+	nitems atomic.Int64
+	nevict atomic.Int64
+	nget   atomic.Int64
+	nhit   atomic.Int64
 }
 
 // 封装Get()和Add()方法
 func (c *cache) get(key string) (value ByteView, ok bool) {
+	c.nget.Add(1)
+	if c.policy.readOnlyGet() {
+		return c.getShared(key)
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
+	if c.ev == nil {
 		return
 	}
-	if v, ok := c.lru.Get(key); ok { // v是entry.value
-		return v.(ByteView), ok
+	v, ok := c.ev.Get(key) // v是entry.value
+	c.updateStats()        // Get时可能惰性删除了过期节点
+	if ok {
+		c.nhit.Add(1)
+	}
+	return v, ok
+}
+
+// 读锁下查找，多个 get可以并发。Get不会删除节点，不需要更新统计值
+func (c *cache) getShared(key string) (value ByteView, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.ev == nil {
+		return
+	}
+	if value, ok = c.ev.Get(key); ok {
+		c.nhit.Add(1)
 	}
 	return
 }
@@ -27,11 +74,64 @@ func (c *cache) get(key string) (value ByteView, ok bool) {
 // add时，加入的是ByteView类型
 // 这里用到了延迟初始化（lazy initializtion)， 就是对象的创建是在第一次使用该对象时
 // 延迟初始化是为了提高性能，减少程序内存要求
+// value.e是过期时间，过期 grace之后才会从缓存里删除，已经超过这个时间的值不会加入
 func (c *cache) add(key string, value ByteView) {
+	var ttl time.Duration
+	if !value.e.IsZero() {
+		if ttl = time.Until(value.e) + c.grace; ttl <= 0 {
+			return
+		}
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+	if c.ev == nil {
+		c.ev = c.policy.newEvictor(c.cacheBytes)
+		c.overhead = c.policy.entryOverhead()
+	}
+	c.ev.AddWithTTL(key, value, ttl)
+	c.updateStats()
+}
+
+func (c *cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ev == nil {
+		return
+	}
+	c.ev.Remove(key)
+	c.updateStats()
+}
+
+// 需要持有 c.mu
+func (c *cache) updateStats() {
+	nbytes, items := c.ev.Bytes(), int64(c.ev.Len())
+	heap := nbytes
+	if r, ok := c.ev.(heapReporter); ok {
+		heap = r.HeapBytes()
+	}
+	c.nheap.Store(heap)
+	c.nbytes.Store(nbytes - items*c.overhead)
+	c.nitems.Store(items)
+	c.nevict.Store(c.ev.Evictions())
+}
+
+// 缓存的统计信息
+type CacheStats struct {
+	Bytes     int64 // key和值的总长度
+	HeapBytes int64 // 估计的堆内存，Bytes加上节点开销，受 cacheBytes限制；ARC的 ghost和 TinyLFU的 sketch另算
+	Items     int64 // 缓存值的个数
+	Gets      int64 // 查找次数
+	Hits      int64 // 命中次数
+	Evictions int64 // 因为内存或者过期被淘汰的个数
+}
+
+func (c *cache) stats() CacheStats {
+	return CacheStats{
+		Bytes:     c.nbytes.Load(),
+		HeapBytes: c.nheap.Load(),
+		Items:     c.nitems.Load(),
+		Gets:      c.nget.Load(),
+		Hits:      c.nhit.Load(),
+		Evictions: c.nevict.Load(),
 	}
-	c.lru.Add(key, value)
 }
@@ -0,0 +1,133 @@
+package geecache
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestShardedCache(t *testing.T) {
+	c := newShardedCache(1<<16, 4, 0, PolicyLRU)
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		c.add(key, ByteView{b: []byte(key)})
+	}
+	if v, ok := c.get("42"); !ok || v.String() != "42" {
+		t.Fatalf("sharded cache hit 42 failed")
+	}
+	c.remove("42")
+	if _, ok := c.get("42"); ok {
+		t.Fatalf("sharded cache remove 42 failed")
+	}
+	if st := c.stats(); st.Items != 99 || st.Gets != 2 || st.Hits != 1 || st.HeapBytes != st.Bytes+99*PolicyLRU.entryOverhead() {
+		t.Fatalf("sharded cache stats = %+v", st)
+	}
+}
+
+func TestCachePolicy(t *testing.T) {
+	// 每个值占 2字节加节点开销，最多放 3个
+	for _, tt := range []struct {
+		policy  Policy
+		evicted string
+	}{
+		{PolicyLRU, "k1"},   // k1最久没有被访问
+		{PolicyLFU, "k2"},   // k1访问次数最多，k2和 k3一样多，淘汰更早访问的 k2
+		{PolicyARC, "k1"},   // 都在 t2里，k1最久没有被访问
+		{PolicySIEVE, "k1"}, // 都访问过，hand转一圈清除标记后回到最早加入的 k1
+		{PolicyCLOCK, "k1"},
+	} {
+		c := &cache{cacheBytes: 3 * (2 + tt.policy.entryOverhead()), policy: tt.policy}
+		for _, key := range []string{"k1", "k2", "k3"} {
+			c.add(key, ByteView{})
+		}
+		for _, key := range []string{"k1", "k1", "k2", "k3"} {
+			c.get(key)
+		}
+		c.add("k4", ByteView{})
+		if _, ok := c.get(tt.evicted); ok {
+			t.Fatalf("%v: %s should be evicted", tt.policy, tt.evicted)
+		}
+		if st := c.stats(); st.Items != 3 || st.Evictions != 1 {
+			t.Fatalf("%v: stats = %+v", tt.policy, st)
+		}
+	}
+}
+
+// 有容量限制的缓存写满之后继续写，一半的 key再访问一次，
+// 估计的堆内存和 runtime.MemStats统计的差别不超过 20%。
+// 写满之后有淘汰，ARC会有 ghost链表，TinyLFU会拒绝新 key，这些内存都要算对
+func TestHeapBytes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("allocates a large population")
+	}
+	const cacheBytes = 4 << 20
+	for _, p := range []Policy{PolicyLRU, PolicyLFU, PolicyARC, PolicyTinyLFU, PolicySIEVE, PolicyCLOCK} {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		c := &cache{cacheBytes: cacheBytes, policy: p}
+		n := int(cacheBytes / (p.entryOverhead() + 40) * 2)
+		for i := 0; i < n; i++ {
+			key := "key" + strconv.Itoa(i)
+			c.add(key, ByteView{b: make([]byte, i%64)})
+			if i%2 == 0 {
+				c.get(key)
+			}
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		heap := float64(after.HeapAlloc) - float64(before.HeapAlloc)
+		st := c.stats()
+		if ratio := float64(st.HeapBytes) / heap; ratio < 0.8 || ratio > 1.2 {
+			t.Errorf("%v: estimated %d bytes, heap grew %.0f bytes, ratio %.2f", p, st.HeapBytes, heap, ratio)
+		}
+		if st.Evictions == 0 && p != PolicyTinyLFU {
+			t.Errorf("%v: cache never filled up", p)
+		}
+		runtime.KeepAlive(c)
+	}
+}
+
+// 并发读写的基准测试，90% get，10% add
+func benchmarkCacheParallel(b *testing.B, c cacher) {
+	const nkeys = 1 << 12
+	keys := make([]string, nkeys)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		c.add(keys[i], ByteView{b: []byte(keys[i])})
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := keys[i%nkeys]
+			if i%10 == 0 {
+				c.add(key, ByteView{b: []byte(key)})
+			} else {
+				c.get(key)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkCacheParallel(b *testing.B) {
+	benchmarkCacheParallel(b, &cache{cacheBytes: 1 << 20})
+}
+
+// get只需要读锁的淘汰算法
+func BenchmarkCacheParallelReadLock(b *testing.B) {
+	for _, p := range []Policy{PolicySIEVE, PolicyCLOCK} {
+		b.Run(p.String(), func(b *testing.B) {
+			benchmarkCacheParallel(b, &cache{cacheBytes: 1 << 20, policy: p})
+		})
+	}
+}
+
+func BenchmarkShardedCacheParallel(b *testing.B) {
+	for _, n := range []int{4, 16, 64} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			benchmarkCacheParallel(b, newShardedCache(1<<20, n, 0, PolicyLRU))
+		})
+	}
+}
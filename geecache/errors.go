@@ -0,0 +1,79 @@
+package geecache
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// Getter返回（或者用 %w包装）这个错误，表示数据源里确实没有这个 key。
+	// 远程节点返回这个错误时，Group不会再回退到本地去数据源查找
+	ErrNotFound    = errors.New("geecache: key not found")
+	ErrNoSuchGroup = errors.New("geecache: no such group")
+	ErrEmptyKey    = errors.New("geecache: key is required")
+	ErrBadRequest  = errors.New("geecache: bad request")
+	// 两个节点的配置指纹不一样（basePath、虚拟节点个数、哈希函数），不能放在同一个集群里
+	ErrConfigMismatch = errors.New("geecache: peer config mismatch")
+)
+
+// 出错时，HTTPPool在这个响应头里写上错误码，httpGetter据此还原成上面的错误。
+// 同样是 404，可以区分是 group不存在还是 key不存在
+const errorHeader = "X-Geecache-Error"
+
+// 错误码
+const (
+	codeNotFound    = "not_found"
+	codeNoSuchGroup = "no_such_group"
+	codeBadRequest  = "bad_request"
+	codeConfig      = "config_mismatch"
+	codeInternal    = "internal" // 数据源或者远程节点出错
+)
+
+// 错误对应的 http状态码和错误码
+func errorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound, codeNotFound
+	case errors.Is(err, ErrNoSuchGroup):
+		return http.StatusNotFound, codeNoSuchGroup
+	case errors.Is(err, ErrEmptyKey), errors.Is(err, ErrBadRequest):
+		return http.StatusBadRequest, codeBadRequest
+	case errors.Is(err, ErrConfigMismatch):
+		return http.StatusConflict, codeConfig
+	default:
+		return http.StatusInternalServerError, codeInternal
+	}
+}
+
+// 返回错误响应，和 http.Error一样，另外带上错误码
+func writeError(w http.ResponseWriter, err error) {
+	status, code := errorStatus(err)
+	w.Header().Set(errorHeader, code)
+	http.Error(w, err.Error(), status)
+}
+
+// 远程节点返回的错误，可以用 errors.Is(err, ErrNotFound)判断
+type PeerError struct {
+	Status int    // http状态码
+	Code   string // 错误码，旧节点不会返回错误码，这时为空
+	Msg    string // 远程节点返回的错误信息
+}
+
+func (e *PeerError) Error() string {
+	return fmt.Sprintf("server returned: %d %s: %s", e.Status, http.StatusText(e.Status), e.Msg)
+}
+
+func (e *PeerError) Unwrap() error {
+	switch e.Code {
+	case codeNotFound:
+		return ErrNotFound
+	case codeNoSuchGroup:
+		return ErrNoSuchGroup
+	case codeBadRequest:
+		return ErrBadRequest
+	case codeConfig:
+		return ErrConfigMismatch
+	}
+	return nil
+}
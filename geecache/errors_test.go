@@ -0,0 +1,87 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newErrorsGroup() *Group {
+	return NewGroup("errors-test", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		switch key {
+		case "missing":
+			return nil, ErrNotFound
+		case "boom":
+			return nil, errors.New("db is down")
+		}
+		return []byte("v-" + key), nil
+	}))
+}
+
+func TestServeHTTPErrors(t *testing.T) {
+	newErrorsGroup()
+	p := NewHTTPPool("http://self")
+	tests := []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{"GET", "/_geecache/", http.StatusBadRequest, codeBadRequest},
+		{"GET", "/_geecache/errors-test", http.StatusBadRequest, codeBadRequest},
+		{"GET", "/_geecache/errors-test/", http.StatusBadRequest, codeBadRequest},
+		{"GET", "/_geecache/no-such-group/k", http.StatusNotFound, codeNoSuchGroup},
+		{"GET", "/_geecache/errors-test/missing", http.StatusNotFound, codeNotFound},
+		{"GET", "/_geecache/errors-test/boom", http.StatusInternalServerError, codeInternal},
+		{"PUT", "/_geecache/errors-test/k", http.StatusMethodNotAllowed, ""},
+		{"GET", "/_geecache/errors-test/k", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.status || w.Header().Get(errorHeader) != tt.code {
+			t.Errorf("%s %s = %d %q, want %d %q", tt.method, tt.path, w.Code, w.Header().Get(errorHeader), tt.status, tt.code)
+		}
+	}
+}
+
+// 远程节点返回的错误在客户端还原成原来的错误，两种格式都一样
+func TestHTTPGetterErrors(t *testing.T) {
+	newErrorsGroup()
+	srv := httptest.NewServer(NewHTTPPool("http://peer"))
+	defer srv.Close()
+	p := NewHTTPPool("http://self")
+	p.Set(srv.URL)
+	getter := p.httpGetters[srv.URL]
+
+	tests := []struct {
+		group, key string
+		want       error // nil表示不能是 ErrNotFound和 ErrNoSuchGroup
+		status     int
+	}{
+		{"errors-test", "missing", ErrNotFound, http.StatusNotFound},
+		{"no-such-group", "k", ErrNoSuchGroup, http.StatusNotFound},
+		{"errors-test", "boom", nil, http.StatusInternalServerError},
+	}
+	for _, raw := range []bool{false, true} {
+		getter.raw.Store(raw)
+		for _, tt := range tests {
+			_, err := getter.getView(context.Background(), tt.group, tt.key)
+			var pe *PeerError
+			if !errors.As(err, &pe) || pe.Status != tt.status {
+				t.Errorf("raw=%v %s/%s: err = %v, want status %d", raw, tt.group, tt.key, err, tt.status)
+				continue
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("raw=%v %s/%s: err = %v, want %v", raw, tt.group, tt.key, err, tt.want)
+			}
+			if tt.want == nil && (errors.Is(err, ErrNotFound) || errors.Is(err, ErrNoSuchGroup)) {
+				t.Errorf("raw=%v %s/%s: server error mapped to %v", raw, tt.group, tt.key, err)
+			}
+		}
+		if v, err := getter.getView(context.Background(), "errors-test", "k"); err != nil || v.String() != "v-k" {
+			t.Errorf("raw=%v: getView = %q, %v", raw, v.String(), err)
+		}
+	}
+}
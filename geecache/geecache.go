@@ -1,10 +1,14 @@
 package geecache
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"math/rand"
 	"module/singleflight"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // 缓存中查不到时，就要去数据源（文件或者数据库）查找。
@@ -26,15 +30,106 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key) // 调用 f 自己本身
 }
 
+// 带 context的 Getter，客户端断开或者超时之后，可以停止去数据源查找。
+// NewGroup传入的 Getter如果也实现了 ContextGetter，就会使用 GetContext
+type ContextGetter interface {
+	GetContext(ctx context.Context, key string) ([]byte, error)
+}
+
+// 接口型函数，同时实现了 Getter和 ContextGetter
+type ContextGetterFunc func(ctx context.Context, key string) ([]byte, error)
+
+func (f ContextGetterFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+func (f ContextGetterFunc) Get(key string) ([]byte, error) {
+	return f(context.Background(), key)
+}
+
 // Group是GEE_CACHE里面最重要的结构。
 // 一个Group可以被认为是一个缓存的命名空间，
 // 可以创建很多Group，他们有自己唯一的名字name
 type Group struct {
 	name      string     // 缓存命名空间
 	getter    Getter     // 缓存未命中时的回调
-	mainCache cache      // 并发缓存
+	mainCache cacher     // 并发缓存，存的是本节点负责的 key
+	shards    int        // mainCache分成多少个分片，<= 1 表示不分片
+	policy    Policy     // mainCache的淘汰算法
 	peers     PeerPicker //节点选择器
 	loader    *singleflight.Group
+	ttl       time.Duration // 缓存值的默认过期时间，0表示永不过期
+	broadcast bool          // Remove时是否通知所有节点，而不仅仅是 key所属的节点
+	// 热点缓存，存的是其他节点负责、但在本节点也被频繁访问的 key，
+	// 避免热点 key每次都要走一次 http请求
+	hotCache cache
+	hotRate  float64       // 从远程节点获取的值，按这个比例采样放入 hotCache
+	hotTTL   time.Duration // hotCache里的值最多保存多久
+	// 负缓存，记住数据源里不存在的 key，避免不存在的 key每次都去查数据源
+	negCache cache
+	negTTL   time.Duration // 负缓存的过期时间，0表示不使用负缓存
+	refresh  refresher     // 后台刷新快要过期或者已经过期的 key
+	stats    groupStats
+	logger   Logger
+}
+
+// Group的计数器，都是原子操作，读的时候不会阻塞 Get
+type groupStats struct {
+	gets           atomic.Int64 // 所有的 Get请求
+	localHits      atomic.Int64 // mainCache或者 hotCache命中
+	negativeHits   atomic.Int64 // negCache命中，直接返回 ErrNotFound
+	staleHits      atomic.Int64 // 返回了已经过期的值（stale-while-revalidate）
+	refreshes      atomic.Int64 // 后台刷新的次数
+	refreshErrors  atomic.Int64 // 后台刷新失败的次数
+	peerLoads      atomic.Int64 // 从远程节点获取成功
+	peerErrors     atomic.Int64 // 从远程节点获取失败
+	getterLoads    atomic.Int64 // 调用回调函数从数据源获取成功
+	getterErrors   atomic.Int64 // 调用回调函数从数据源获取失败
+	loadsDeduped   atomic.Int64 // 被 singleflight合并、没有真正去加载的请求
+	serverRequests atomic.Int64 // 通过 HTTPPool处理的其他节点的请求
+}
+
+// Group.Stats()返回的快照
+type Stats struct {
+	Gets           int64
+	LocalHits      int64
+	NegativeHits   int64
+	StaleHits      int64
+	Refreshes      int64
+	RefreshErrors  int64
+	PeerLoads      int64
+	PeerErrors     int64
+	GetterLoads    int64
+	GetterErrors   int64
+	LoadsDeduped   int64
+	ServerRequests int64
+	MainCache      CacheStats
+	HotCache       CacheStats
+	NegativeCache  CacheStats
+}
+
+// 缓存类型，用于 CacheStats
+type CacheType int
+
+const (
+	MainCache     CacheType = iota + 1 // 本节点负责的 key
+	HotCache                           // 从远程节点获取的热点 key
+	NegativeCache                      // 数据源里不存在的 key
+)
+
+const (
+	defaultHotRate = 0.1
+	defaultHotTTL  = time.Minute
+)
+
+// NewGroup的可选配置
+type GroupOption func(*Group)
+
+// 设置 Group的默认过期时间，从数据源加载的值在 ttl之后过期
+func WithTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttl = ttl
+	}
 }
 
 var (
@@ -42,18 +137,78 @@ var (
 	groups = make(map[string]*Group)
 )
 
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+// Remove时广播给所有节点。
+// 从远程节点获取失败时会回退到本地加载，所以非所属节点上也可能存在副本。
+// 打开了热点缓存的话，不设置也会广播
+func WithRemoveBroadcast() GroupOption {
+	return func(g *Group) {
+		g.broadcast = true
+	}
+}
+
+// 设置 Group的日志，默认不输出日志
+func WithLogger(l Logger) GroupOption {
+	return func(g *Group) {
+		g.logger = l
+	}
+}
+
+// 打开负缓存：数据源返回 ErrNotFound的 key，在 ttl内直接返回 ErrNotFound，不再去查数据源。
+// 远程节点返回的 ErrNotFound也会缓存。ttl应该比较短。
+// negBytes是负缓存估计的最大堆内存，每个 key占 len(key)加上 lru.EntryOverhead（两百字节左右），
+// 比如 1<<20大概能记住 5000多个 key。ttl和 negBytes都必须大于 0
+func WithNegativeCache(ttl time.Duration, negBytes int64) GroupOption {
+	if ttl <= 0 || negBytes <= 0 {
+		panic("WithNegativeCache: ttl and negBytes must be positive")
+	}
+	return func(g *Group) {
+		g.negTTL = ttl
+		g.negCache = cache{cacheBytes: negBytes}
+	}
+}
+
+// 把 mainCache分成 n个分片，每个分片有自己的锁，内存上限平分。
+// 并发读很多的时候可以减少锁竞争
+func WithShards(n int) GroupOption {
+	return func(g *Group) {
+		g.shards = n
+	}
+}
+
+// 打开热点缓存，默认不使用。hotBytes是最大内存，rate是采样比例，<= 0 时为 defaultHotRate。
+// 热点缓存里的值最多保存 ttl（<= 0 时为 defaultHotTTL）。
+// 打开热点缓存后 Remove会广播给所有节点，广播没有送达的节点最多还会返回 ttl这么久的旧值
+func WithHotCache(hotBytes int64, rate float64, ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		if rate <= 0 {
+			rate = defaultHotRate
+		}
+		if ttl <= 0 {
+			ttl = defaultHotTTL
+		}
+		g.hotCache = cache{cacheBytes: hotBytes}
+		g.hotRate, g.hotTTL = rate, ttl
+	}
+}
+
+// cacheBytes是 mainCache估计的最大堆内存，每个值除了 key和值的长度，还要算上淘汰算法的节点开销，
+// 见各个包的 EntryOverhead
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
 	mu.Lock()
 	defer mu.Unlock()
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    &singleflight.Group{},
+		name:   name,
+		getter: getter,
+		loader: &singleflight.Group{},
+		logger: noopLogger{},
+	}
+	for _, opt := range opts {
+		opt(g)
 	}
+	g.mainCache = newMainCache(cacheBytes, g.shards, g.refresh.policy.StaleFor, g.policy)
 	groups[name] = g
 	return g
 }
@@ -67,65 +222,279 @@ func GetGroup(name string) *Group {
 
 // Group的Get()方法，返回的是只读结构的缓存值
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// 和 Get一样，ctx被取消时提前返回 ctx.Err()。
+// 其他请求还在等待同一个 key的话，加载会继续进行
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
+	g.stats.gets.Add(1)
 	if key == "" {
-		return ByteView{}, fmt.Errorf("key is required")
+		return ByteView{}, ErrEmptyKey
 	}
-	if v, ok := g.mainCache.get(key); ok { // 如果本地的mainCache中有，直接返回
-		log.Printf("geecache | get from local cache: %v \n", v)
+	if v, ok := g.lookupCache(key); ok { // 如果本地有，直接返回
 		return v, nil
 	}
-	return g.load(key) // 如果缓存未被命中，要从数据源获取；或者从分布式环境中的其他节点获取
+	if err := g.lookupNegative(key); err != nil { // 不久前确认过数据源里没有
+		return ByteView{}, err
+	}
+	return g.load(ctx, key) // 如果缓存未被命中，要从数据源获取；或者从分布式环境中的其他节点获取
+}
+
+// 依次查找 mainCache和 hotCache
+func (g *Group) lookupCache(key string) (ByteView, bool) {
+	if v, ok := g.mainCache.get(key); ok { // 本节点负责的 key
+		g.stats.localHits.Add(1)
+		g.logger.Debugf("geecache | get from local cache: %v", key)
+		g.maybeRefresh(key, v) // 过期了或者快要过期，在后台重新加载
+		return v, true
+	}
+	if v, ok := g.hotCache.get(key); ok { // 其他节点负责的热点 key
+		g.stats.localHits.Add(1)
+		g.logger.Debugf("geecache | get from hot cache: %v", key)
+		return v, true
+	}
+	return ByteView{}, false
+}
+
+// 在负缓存里查找，命中时返回 ErrNotFound
+func (g *Group) lookupNegative(key string) error {
+	if g.negTTL <= 0 {
+		return nil
+	}
+	if _, ok := g.negCache.get(key); ok {
+		g.stats.negativeHits.Add(1)
+		g.logger.Debugf("geecache | get from negative cache: %v", key)
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return nil
+}
+
+// 记住数据源里没有这个 key，没有打开负缓存时什么也不做
+func (g *Group) addNegative(key string) {
+	if g.negTTL <= 0 {
+		return
+	}
+	g.negCache.add(key, ByteView{e: time.Now().Add(g.negTTL)})
 }
 
 // 先通过 PickPeer选择节点，
 // singleflight实现的 Do()方法，使得并发调用 Do()时，匿名函数只被调用一次
-func (g *Group) load(key string) (val ByteView, err error) {
-	viewi, err := g.loader.Do(key, func() (interface{}, error) { // Do的第二个参数是个匿名函数，能返回interface和error就行
-		log.Printf("geecache | group.load() : g.name: %v, g.peers: %v", g.name, g.peers)
+func (g *Group) load(ctx context.Context, key string) (val ByteView, err error) {
+	// DoContext的第三个参数是个匿名函数，能返回interface和error就行。
+	// 匿名函数在单独的 goroutine里执行，传进去的 ctx只有在所有等待者都放弃后才会被取消
+	viewi, err, shared := g.loader.DoContext(ctx, key, g.loadFunc(key))
+	if shared { // 加入了正在进行中的加载，说明这次请求被合并了
+		g.stats.loadsDeduped.Add(1)
+	}
+
+	if err == nil {
+		return viewi.(ByteView), nil
+	}
+	return
+}
+
+// 真正的加载过程：先尝试 key所属的远程节点，失败了再调用回调函数从数据源获取
+func (g *Group) loadFunc(key string) func(ctx context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		g.logger.Debugf("geecache | group.load() : g.name: %v, key: %v", g.name, key)
 		if g.peers != nil {
 			if peer, ok := g.peers.PickPeer(key); ok {
-				if val, err = g.getFromPeer(peer, key); err == nil {
-					log.Println("[GetCache] Success to get byteview from peer: ", val)
+				val, err := g.getFromPeer(ctx, peer, key)
+				if err == nil {
+					g.stats.peerLoads.Add(1)
+					g.logger.Debugf("[GetCache] Success to get %v from peer", key)
 					return val, nil
 				}
-				log.Println("[GetCache] Failed to get from peer", err)
+				if errors.Is(err, ErrNotFound) { // 所属节点确认数据源里没有，不用再本地查一遍
+					g.addNegative(key)
+					return nil, err
+				}
+				g.stats.peerErrors.Add(1)
+				if errors.Is(err, ErrBreakerOpen) { // 熔断器打开时每次都会失败，状态变化已经有回调了
+					g.logger.Debugf("[GetCache] Skip peer: %v", err)
+				} else {
+					g.logger.Errorf("[GetCache] Failed to get from peer: %v", err)
+				}
 			}
 		}
-		return g.getLocally(key)
-	})
-
-	if err == nil {
-		return viewi.(ByteView), nil
+		return g.getLocally(ctx, key)
 	}
-	return
 }
 
 // 实现 PeerGetter接口的 httpGetter从访问远程节点，获取缓存值
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
-	bytes, err := peer.Get(g.name, key) // httpGetter.Get()
+// 如果 peer实现了 ContextPeerGetter，会把 ctx传下去
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
+	if vg, ok := peer.(viewGetter); ok { // httpGetter，带过期时间
+		value, err := vg.getView(ctx, g.name, key)
+		if err != nil {
+			return ByteView{}, err
+		}
+		g.maybeAddHot(key, value)
+		return value, nil
+	}
+
+	var (
+		bytes []byte
+		err   error
+	)
+	if cp, ok := peer.(ContextPeerGetter); ok {
+		bytes, err = cp.GetContext(ctx, g.name, key) // httpGetter.GetContext()
+	} else {
+		bytes, err = peer.Get(g.name, key)
+	}
 	if err != nil {
 		return ByteView{}, err
 	}
-	log.Printf("geecache | getFromPeer: %v, %v\n", bytes, g.name)
-	return ByteView{b: bytes}, nil
+	value := ByteView{b: bytes}
+	g.maybeAddHot(key, value)
+	return value, nil
+}
+
+// 从远程节点获取的值，只采样一部分放入 hotCache
+func (g *Group) maybeAddHot(key string, value ByteView) {
+	if g.hotCache.cacheBytes > 0 && rand.Float64() < g.hotRate {
+		g.addHot(key, value)
+	}
+}
+
+// 放入 hotCache，过期时间不超过 hotTTL。没有打开热点缓存时什么也不做
+func (g *Group) addHot(key string, value ByteView) {
+	if g.hotCache.cacheBytes <= 0 {
+		return
+	}
+	if limit := time.Now().Add(g.hotTTL); value.e.IsZero() || value.e.After(limit) {
+		value.e = limit
+	}
+	g.hotCache.add(key, value)
+}
+
+// 按默认过期时间计算的过期时间点，没有设置过期时间时返回零值
+func (g *Group) expireAt() time.Time {
+	if g.ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(g.ttl)
 }
 
 // 主要是调用用户的回调函数（从数据源获取数据）
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key) // 用户的回调函数
-	if err != nil {                 // 回调去数据源查也没有查到
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	var (
+		bytes []byte
+		err   error
+	)
+	if cg, ok := g.getter.(ContextGetter); ok { // 用户的回调函数
+		bytes, err = cg.GetContext(ctx, key)
+	} else {
+		bytes, err = g.getter.Get(key)
+	}
+	if err != nil { // 回调去数据源查也没有查到
+		g.stats.getterErrors.Add(1)
+		if errors.Is(err, ErrNotFound) {
+			g.addNegative(key)
+		}
 		return ByteView{}, err
 	}
-	value := ByteView{b: cloneBytes(bytes)}
+	g.stats.getterLoads.Add(1)
+	value := ByteView{b: cloneBytes(bytes), e: g.expireAt()}
 	g.populateCache(key, value)
-	log.Printf("geecache | getLocally: get from getter")
+	g.logger.Debugf("geecache | getLocally: get %v from getter", key)
 	return value, nil
 }
 
 // 将源数据添加到本地mainCache缓存
 func (g *Group) populateCache(key string, value ByteView) {
 	g.mainCache.add(key, value)
-	log.Println("geecache | populateCache: add value to local cache")
+}
+
+// 删除 key对应的缓存值。
+// 先删除本地缓存，注册了节点的话，再通知 key所属的节点删除。
+// 打开了 WithRemoveBroadcast或者热点缓存时通知所有节点，其他节点的 hotCache里也可能有副本
+func (g *Group) Remove(key string) error {
+	if key == "" {
+		return ErrEmptyKey
+	}
+	g.removeLocally(key)
+	if g.peers == nil {
+		return nil
+	}
+
+	var targets []PeerGetter
+	if lister, ok := g.peers.(PeerLister); ok && (g.broadcast || g.hotCache.cacheBytes > 0) {
+		targets = lister.ListPeers()
+	} else if peer, ok := g.peers.PickPeer(key); ok {
+		targets = []PeerGetter{peer}
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	for _, peer := range targets {
+		remover, ok := peer.(PeerRemover)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(remover PeerRemover) {
+			defer wg.Done()
+			if err := remover.Remove(g.name, key); err != nil {
+				g.logger.Errorf("[RemoveCache] Failed to remove from peer: %v", err)
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMu.Unlock()
+			}
+		}(remover)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// 只删除本地的缓存值，远程节点发来的删除请求走这里，避免再次转发
+func (g *Group) removeLocally(key string) {
+	g.refresh.markRemoved(key) // 在删除之前标记，正在进行的刷新不会再把旧的值放回去
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+	g.negCache.remove(key)
+	g.logger.Debugf("geecache | removeLocally: %v", key)
+}
+
+// 返回 mainCache或者 hotCache的统计信息
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.stats()
+	case HotCache:
+		return g.hotCache.stats()
+	case NegativeCache:
+		return g.negCache.stats()
+	default:
+		return CacheStats{}
+	}
+}
+
+// 返回 Group当前统计值的快照，可以和 Get并发调用
+func (g *Group) Stats() Stats {
+	return Stats{
+		Gets:           g.stats.gets.Load(),
+		LocalHits:      g.stats.localHits.Load(),
+		NegativeHits:   g.stats.negativeHits.Load(),
+		StaleHits:      g.stats.staleHits.Load(),
+		Refreshes:      g.stats.refreshes.Load(),
+		RefreshErrors:  g.stats.refreshErrors.Load(),
+		PeerLoads:      g.stats.peerLoads.Load(),
+		PeerErrors:     g.stats.peerErrors.Load(),
+		GetterLoads:    g.stats.getterLoads.Load(),
+		GetterErrors:   g.stats.getterErrors.Load(),
+		LoadsDeduped:   g.stats.loadsDeduped.Load(),
+		ServerRequests: g.stats.serverRequests.Load(),
+		MainCache:      g.mainCache.stats(),
+		HotCache:       g.hotCache.stats(),
+		NegativeCache:  g.negCache.stats(),
+	}
 }
 
 // 将实现了PeerPicker接口的 HTTPPool注入到 Group中
@@ -134,5 +503,5 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 		panic("RegisterPeerPicker called more than once")
 	}
 	g.peers = peers
-	log.Printf("geecache | RegisterPeers: %v \n", g.peers)
+	g.logger.Infof("geecache | RegisterPeers: %v", g.name)
 }
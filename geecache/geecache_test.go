@@ -0,0 +1,102 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 过期之后再 Get，要通过 Getter重新加载，不能一直返回旧值
+func TestTTLReload(t *testing.T) {
+	var version atomic.Int64
+	g := NewGroup("ttl-reload", 1<<20, versionGetter(&version), WithTTL(20*time.Millisecond))
+	if v, _ := g.Get("k"); v.String() != "k1" {
+		t.Fatalf("Get = %q, want k1", v.String())
+	}
+	if v, _ := g.Get("k"); v.String() != "k1" {
+		t.Fatalf("Get before expiry = %q, want cached k1", v.String())
+	}
+	time.Sleep(30 * time.Millisecond)
+	for _, want := range []string{"k2", "k3"} {
+		v, err := g.Get("k")
+		if err != nil || v.String() != want {
+			t.Fatalf("Get after expiry = %q, %v, want %s", v.String(), err, want)
+		}
+		time.Sleep(30 * time.Millisecond)
+	}
+	if n := version.Load(); n != 3 {
+		t.Fatalf("getter called %d times, want 3", n)
+	}
+}
+
+// 一个调用方放弃了，Getter的 ctx还没有被取消，另一个等待者能拿到结果
+func TestGetContextCanceled(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	g := NewGroup("ctx-canceled", 1<<20, ContextGetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		close(started)
+		select {
+		case <-release:
+			return []byte("v-" + key), nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := g.GetContext(ctx, "k")
+		first <- err
+	}()
+	<-started
+	second := make(chan ByteView)
+	go func() {
+		v, _ := g.GetContext(context.Background(), "k")
+		second <- v
+	}()
+	time.Sleep(20 * time.Millisecond) // 等第二个调用方加入
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled GetContext err = %v, want context.Canceled", err)
+	}
+	close(release)
+	if v := <-second; v.String() != "v-k" {
+		t.Fatalf("second GetContext = %q, want v-k", v.String())
+	}
+	if n := g.Stats().LoadsDeduped; n != 1 {
+		t.Fatalf("LoadsDeduped = %d, want the second caller to join the first load", n)
+	}
+}
+
+// 请求方断开连接，ServeHTTP把 r.Context()传给加载，唯一的等待者放弃后 Getter的 ctx被取消
+func TestServeHTTPContext(t *testing.T) {
+	started, canceled := make(chan struct{}), make(chan struct{})
+	NewGroup("ctx-serve", 1<<20, ContextGetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		close(started)
+		<-ctx.Done()
+		close(canceled)
+		return nil, ctx.Err()
+	}))
+	srv := httptest.NewServer(NewHTTPPool("http://self"))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+defaultBasePath+"ctx-serve/k", nil)
+	go func() {
+		<-started
+		cancel()
+	}()
+	if res, err := http.DefaultClient.Do(req); err == nil {
+		res.Body.Close()
+		t.Fatalf("request finished with %s, want it canceled", res.Status)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatalf("Getter ctx not canceled after the client went away")
+	}
+}
@@ -0,0 +1,165 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 健康检查的路径，GET basePath + healthPath 返回 200
+const healthPath = "_health"
+
+const (
+	defaultHealthInterval = 5 * time.Second
+	defaultHealthTimeout  = time.Second
+	defaultFailThreshold  = 3
+)
+
+// 节点健康检查的配置，零值字段使用默认值
+type HealthCheck struct {
+	Interval      time.Duration // 探测间隔
+	Timeout       time.Duration // 每次探测的超时时间
+	FailThreshold int           // 连续失败多少次标记为 down
+}
+
+// 远程节点的健康状态
+type PeerState struct {
+	Addr      string
+	Up        bool
+	Failures  int          // 连续失败的次数
+	LastCheck time.Time    // 上一次探测的时间，零值表示还没有探测过
+	LastError string       // 上一次探测失败的原因
+	Breaker   BreakerState // 熔断器的状态，没有熔断器时总是 closed
+}
+
+// httpGetter的健康状态，由 HTTPPool.mu保护
+type peerHealth struct {
+	down      bool
+	failures  int
+	lastCheck time.Time
+	lastErr   string
+}
+
+// 健康检查只说明这个进程还能处理请求，不检查数据源
+func (p *HTTPPool) serveHealth(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// 定期探测所有远程节点，连续失败 FailThreshold次的节点从哈希环里去掉，
+// 它负责的 key交给环上的其他节点（或者本节点），探测成功一次就加回来。
+// 调用返回的 stop停止探测
+func (p *HTTPPool) StartHealthCheck(hc HealthCheck) (stop func()) {
+	if hc.Interval <= 0 {
+		hc.Interval = defaultHealthInterval
+	}
+	if hc.Timeout <= 0 {
+		hc.Timeout = defaultHealthTimeout
+	}
+	if hc.FailThreshold <= 0 {
+		hc.FailThreshold = defaultFailThreshold
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(hc.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				p.checkPeers(hc)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// 并发探测一轮，down的节点从哈希环上删掉，恢复的节点加回去
+func (p *HTTPPool) checkPeers(hc HealthCheck) {
+	getters := p.sortedGetters()
+	errs := make([]error, len(getters))
+	var wg sync.WaitGroup
+	for i, getter := range getters {
+		wg.Add(1)
+		go func(i int, getter *httpGetter) {
+			defer wg.Done()
+			errs[i] = getter.probe(hc.Timeout)
+		}(i, getter)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	now := time.Now()
+	var up, down []string
+	for i, getter := range getters {
+		if p.httpGetters[getter.addr] != getter { // 探测期间节点被删除或者调用了 Set
+			continue
+		}
+		h := &getter.health
+		h.lastCheck = now
+		if errs[i] == nil {
+			if h.down {
+				p.logger.Infof("httppool | peer %s is up", getter.addr)
+				up = append(up, getter.addr)
+			}
+			h.down, h.failures, h.lastErr = false, 0, ""
+			continue
+		}
+		h.failures++
+		h.lastErr = errs[i].Error()
+		if !h.down && h.failures >= hc.FailThreshold {
+			p.logger.Errorf("httppool | peer %s is down after %d failed checks: %v", getter.addr, h.failures, errs[i])
+			h.down = true
+			down = append(down, getter.addr)
+		}
+	}
+	changes := p.updateRing(down, up)
+	p.mu.Unlock()
+	p.notifyOwnership(changes)
+}
+
+// 请求远程节点的健康检查路径
+func (h *httpGetter) probe(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := h.newRequest(ctx, http.MethodGet, h.baseURL+healthPath, nil)
+	if err != nil {
+		return err
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<10)) // 读完 body，连接才能复用
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned %s", res.Status)
+	}
+	return nil
+}
+
+// 所有远程节点的健康状态，按地址排序
+func (p *HTTPPool) PeerStates() []PeerState {
+	getters := p.sortedGetters()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	states := make([]PeerState, 0, len(getters))
+	for _, getter := range getters {
+		h := getter.health
+		states = append(states, PeerState{
+			Addr:      getter.addr,
+			Up:        !h.down,
+			Failures:  h.failures,
+			LastCheck: h.lastCheck,
+			LastError: h.lastErr,
+			Breaker:   getter.breaker.State(),
+		})
+	}
+	return states
+}
@@ -0,0 +1,64 @@
+package geecache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheck(t *testing.T) {
+	var failing atomic.Bool
+	peer := NewHTTPPool("")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		peer.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	self := "http://self"
+	p := NewHTTPPool(self)
+	p.Set(self, srv.URL)
+	hc := HealthCheck{Timeout: time.Second, FailThreshold: 2}
+	ownedByPeer := func() int {
+		n := 0
+		for i := 0; i < 100; i++ {
+			if _, ok := p.PickPeer(string(rune('a' + i))); ok {
+				n++
+			}
+		}
+		return n
+	}
+	if ownedByPeer() == 0 {
+		t.Fatalf("peer should own some keys before checks")
+	}
+
+	failing.Store(true)
+	p.checkPeers(hc)
+	if st := p.PeerStates(); len(st) != 1 || !st[0].Up || st[0].Failures != 1 {
+		t.Fatalf("one failure should not mark peer down: %+v", st)
+	}
+	p.checkPeers(hc)
+	if st := p.PeerStates(); st[0].Up || st[0].LastError == "" {
+		t.Fatalf("peer should be down after 2 failures: %+v", st)
+	}
+	if n := ownedByPeer(); n != 0 {
+		t.Fatalf("down peer still owns %d keys", n)
+	}
+	if n := len(p.ListPeers()); n != 0 {
+		t.Fatalf("ListPeers returned %d down peers", n)
+	}
+
+	failing.Store(false)
+	p.checkPeers(hc)
+	if st := p.PeerStates(); !st[0].Up || st[0].Failures != 0 {
+		t.Fatalf("peer should be up after a successful check: %+v", st)
+	}
+	if ownedByPeer() == 0 {
+		t.Fatalf("restored peer should own keys again")
+	}
+}
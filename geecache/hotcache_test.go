@@ -0,0 +1,75 @@
+package geecache
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingPeer struct {
+	gets atomic.Int64
+}
+
+func (p *countingPeer) Get(group string, key string) ([]byte, error) {
+	p.gets.Add(1)
+	return []byte("peer-" + key), nil
+}
+
+func newHotGroup(name string, peer PeerGetter, opts ...GroupOption) *Group {
+	g := NewGroup(name, 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local-" + key), nil
+	}), opts...)
+	g.RegisterPeers(fakePicker{peer})
+	return g
+}
+
+func TestHotCacheDisabled(t *testing.T) {
+	peer := &countingPeer{}
+	g := newHotGroup("hot-disabled", peer)
+	g.Get("pk")
+	g.Get("pk")
+	if n := peer.gets.Load(); n != 2 {
+		t.Fatalf("peer called %d times, want 2 without hot cache", n)
+	}
+	if st := g.CacheStats(HotCache); st.Items != 0 {
+		t.Fatalf("hot cache has %d items, should be off by default", st.Items)
+	}
+}
+
+func TestHotCache(t *testing.T) {
+	peer := &countingPeer{}
+	g := newHotGroup("hot-all", peer, WithHotCache(1<<20, 1, 20*time.Millisecond))
+	for i := 0; i < 3; i++ {
+		if v, _ := g.Get("pk"); v.String() != "peer-pk" {
+			t.Fatalf("Get = %q, want peer-pk", v.String())
+		}
+	}
+	if n := peer.gets.Load(); n != 1 {
+		t.Fatalf("peer called %d times, want 1", n)
+	}
+	st := g.CacheStats(HotCache)
+	if st.Items != 1 || st.Hits != 2 || st.Gets != 3 {
+		t.Fatalf("hot cache stats = %+v, want 1 item, 2 hits of 3 gets", st)
+	}
+	if n := g.Stats().LocalHits; n != 2 {
+		t.Fatalf("LocalHits = %d, want 2", n)
+	}
+
+	// 超过 ttl之后重新从远程节点获取
+	time.Sleep(30 * time.Millisecond)
+	g.Get("pk")
+	if n := peer.gets.Load(); n != 2 {
+		t.Fatalf("expired hot copy served, peer called %d times", n)
+	}
+}
+
+func TestHotCacheSampling(t *testing.T) {
+	g := newHotGroup("hot-sampled", &countingPeer{}, WithHotCache(1<<24, 0.5, 0))
+	for i := 0; i < 2000; i++ {
+		g.Get("p" + strconv.Itoa(i))
+	}
+	if n := g.CacheStats(HotCache).Items; n < 800 || n > 1200 {
+		t.Fatalf("hot cache sampled %d of 2000 values, want about 1000", n)
+	}
+}
@@ -1,14 +1,18 @@
 package geecache
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	ch "module/consistenthash"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -18,103 +22,358 @@ const (
 
 // http通信的服务端
 type HTTPPool struct {
-	self        string // 自己的地址, ip+port
-	basePath    string // 节点间通讯地址的前缀。和主机上承载的其他服务区分开
+	self        string  // 自己的地址, ip+port
+	basePath    string  // 节点间通讯地址的前缀。和主机上承载的其他服务区分开
+	replicas    int     // 每个节点的虚拟节点个数
+	hash        ch.Hash // 一致性哈希的哈希函数，nil表示默认的 crc32
+	hashName    string
+	fingerprint string // 上面几个配置的指纹
+	onOwnership func(changes []ch.Range)
 	mu          sync.Mutex
-	peers       *ch.Map                // 根据 key选择对应的节点（用一致性哈希）
+	peers       *ch.Map                // 根据 key选择对应的节点（用一致性哈希），不包括 down的节点
 	httpGetters map[string]*httpGetter // 节点与对应的 httpGetter一一映射。每一个远程节点对应一个 httpGetter
+	logger      Logger
+	rawFormat   bool           // httpGetter是否使用原始字节格式
+	breaker     *BreakerPolicy // 不为 nil时每个 httpGetter都有一个熔断器
+	client      *http.Client   // httpGetter请求远程节点用的客户端
+	timeout     time.Duration  // 每个请求的超时时间
+	// 每个节点的请求耗时，节点被删除或者重新 Set之后也保留，导出的计数器不会变小
+	latencies map[string]*histogram
 }
 
 // 初始化节点的 httpPool
-func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
+func NewHTTPPool(self string, opts ...HTTPPoolOption) *HTTPPool {
+	p := &HTTPPool{
 		self:     self,
 		basePath: defaultBasePath,
+		replicas: defaultReplicas,
+		hashName: defaultHashName,
+		logger:   noopLogger{},
+		client:   TransportOptions{}.client(),
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.fingerprint = p.Fingerprint()
+	return p
+}
+
+// 设置 HTTPPool的日志，之后 Set创建的 httpGetter也使用这个日志。默认不输出日志。
+// 需要在开始处理请求之前调用
+func (p *HTTPPool) SetLogger(l Logger) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.logger = l
+}
+
+// 设置之后 Set创建的 httpGetter是否使用原来的原始字节格式。
+// 不打开时遇到不支持二进制协议的旧节点也会自动切换，打开可以省掉第一次失败的请求。需要在 Set之前调用
+func (p *HTTPPool) SetRawFormat(raw bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rawFormat = raw
+}
+
+// 给之后 Set创建的每个 httpGetter加上熔断器，远程节点连续失败时不再等它超时，
+// 直接回退到本地加载。需要在 Set之前调用
+func (p *HTTPPool) SetBreaker(policy BreakerPolicy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.breaker = &policy
 }
 
 // 自身节点url 与 映射的节点url
 func (p *HTTPPool) Log(format string, v ...interface{}) {
-	log.Printf("[Server %s %s]", p.self, fmt.Sprintf(format, v...))
+	p.logger.Infof("[Server %s %s]", p.self, fmt.Sprintf(format, v...))
 }
 
 // 作为通信的Server端，实现的逻辑
+// 路径格式不对返回 400，group不存在返回 404，
+// 数据源里没有这个 key返回 404，其他加载错误返回 500，都在 errorHeader里带上错误码
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if !strings.HasPrefix(r.URL.Path, p.basePath) {
-		panic("HTTPPool serving unexpected path: " + r.URL.Path)
+		http.NotFound(w, r)
+		return
+	}
+	p.logger.Debugf("[Server %s] %s %s", p.self, r.Method, r.URL.Path)
+
+	if !p.checkFingerprint(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") == WireContentType { // 二进制格式，group和 key在 body里
+		p.serveWire(w, r)
+		return
+	}
+	if r.URL.Path == p.basePath+healthPath { // 其他节点的健康检查
+		p.serveHealth(w)
+		return
 	}
-	p.Log("%s %s", r.Method, r.URL.Path)
 
-	// /basePath/groupname/key
+	// /basePath/groupname/key，批量请求是 POST /basePath/groupname
 	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
 	groupName := parts[0]
-	key := parts[1]
+	if groupName == "" {
+		writeError(w, fmt.Errorf("%w: missing group in path %s", ErrBadRequest, r.URL.Path))
+		return
+	}
 
 	group := GetGroup(groupName)
 	if group == nil {
-		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
+		writeError(w, fmt.Errorf("%w: %s", ErrNoSuchGroup, groupName))
+		return
+	}
+	group.stats.serverRequests.Add(1)
+
+	if r.Method == http.MethodPost && len(parts) == 1 {
+		p.serveBatch(w, r, group)
+		return
+	}
+	if len(parts) == 1 || parts[1] == "" {
+		writeError(w, fmt.Errorf("%w: missing key in path %s", ErrBadRequest, r.URL.Path))
 		return
 	}
+	key := parts[1]
 
-	bView, err := group.Get(key)
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodDelete: // 其他节点发来的删除请求，只删除本地缓存
+		group.removeLocally(key)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", "GET, HEAD, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	bView, err := group.GetContext(r.Context(), key) // 请求方断开连接后，不再继续加载
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
+		return
 	}
 
 	// 将缓存值作为 http.Response的Body返回
 	w.Header().Set("Content-Type", "application/octet-stream") // 二进制流
 	w.Write(bView.ByteSlice())                                 // content是字节数组
-
 }
 
 // -------------------- 下面是 http Client的实现
 // http通信的客户端
 type httpGetter struct {
-	baseURL string
+	baseURL     string
+	addr        string     // 远程节点地址，作为指标的 peer标签
+	latency     *histogram // 请求耗时
+	logger      Logger
+	raw         atomic.Bool // 用原始字节格式，而不是二进制协议，发现对方是旧节点时也会打开
+	health      peerHealth  // 健康检查的结果
+	breaker     *breaker    // 熔断器，nil表示不使用
+	client      *http.Client
+	timeout     time.Duration // 每个请求的超时时间，0表示不限制
+	fingerprint string        // 本节点的配置指纹，放在请求头里
 }
 
 // 通信的客户端类 httpGetter，实现 PeerGetter接口
-// 从group查找key的只读缓存: 调用 http.Get(url)
+// 从group查找key的只读缓存: 向远程节点发 GET请求
 func (h *httpGetter) Get(groupName string, key string) ([]byte, error) {
+	return h.GetContext(context.Background(), groupName, key)
+}
+
+// 带 context的 Get，ctx被取消时 http请求也会被取消
+func (h *httpGetter) GetContext(ctx context.Context, groupName string, key string) (_ []byte, err error) {
+	if err := h.breaker.allow(); err != nil {
+		return nil, err
+	}
+	defer func() { h.breaker.done(err) }()
 	u := fmt.Sprintf(
 		"%v%v/%v",
 		h.baseURL,
 		url.QueryEscape(groupName), // groupName
 		url.QueryEscape(key),
 	)
-	log.Printf("httpGetter | Get from url: %v \n", u)
-	res, err := http.Get(u)
+	h.logger.Debugf("httpGetter | Get from url: %v", u)
+	start := time.Now()
+	defer func() { h.latency.observe(time.Since(start)) }()
+	ctx, cancel := h.requestContext(ctx)
+	defer cancel()
+	req, err := h.newRequest(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := h.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned: %v", res.Status)
+		return nil, readPeerError(res)
 	}
 	bytes, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return nil, fmt.Errorf("reading response body: %v", err)
 	}
-	log.Println("httpGetter | http.Get(u) success, return bytes")
 	return bytes, nil
 }
 
+// 通知远程节点删除缓存值: 向同样的 url发送 DELETE请求
+func (h *httpGetter) Remove(groupName string, key string) (err error) {
+	if err := h.breaker.allow(); err != nil {
+		return err
+	}
+	defer func() { h.breaker.done(err) }()
+	u := fmt.Sprintf(
+		"%v%v/%v",
+		h.baseURL,
+		url.QueryEscape(groupName),
+		url.QueryEscape(key),
+	)
+	ctx, cancel := h.requestContext(context.Background())
+	defer cancel()
+	req, err := h.newRequest(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return err
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return readPeerError(res)
+	}
+	return nil
+}
+
+// 把错误响应还原成 *PeerError
+func readPeerError(res *http.Response) error {
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1<<10))
+	return &PeerError{
+		Status: res.StatusCode,
+		Code:   res.Header.Get(errorHeader),
+		Msg:    strings.TrimSpace(string(msg)),
+	}
+}
+
 // 这种定义方式，用来检测 httpGetter是否实现了 PeerGetter接口，
 // 如果没有实现，那么源码编译时则会报错
 var _ PeerGetter = (*httpGetter)(nil)
+var _ ContextPeerGetter = (*httpGetter)(nil)
+var _ PeerRemover = (*httpGetter)(nil)
 
-// 实例化一致性哈希算法，添加传入真实节点，为每一个节点创建一个http客户端 httpGetter
+// 实例化一致性哈希算法，添加传入真实节点，为每一个节点创建一个http客户端 httpGetter。
+// 原来的哈希环和 httpGetter全部丢掉，只增删部分节点时用 AddPeers和 RemovePeers
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.peers = ch.New(defaultReplicas, nil) // p.peers是一致性哈希数据结构 Map（初始化）
-	p.peers.Add(peers...)                  // 传入的peers就是真实节点url，Add之后创建了带虚拟节点的哈希环
+	old := p.peers
+	p.peers = ch.New(p.replicas, p.hash) // p.peers是一致性哈希数据结构 Map（初始化）
+	p.peers.Add(peers...)                // 传入的peers就是真实节点url，Add之后创建了带虚拟节点的哈希环
 	p.httpGetters = make(map[string]*httpGetter, len(peers))
 	for _, peer := range peers { // peer: http://localhost:8001
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
-		// log.Printf("httppool | Set peers: %v, %v\n", p.httpGetters, p.peers)
-		log.Printf("httppool | Set peers: %v | baseURL: %v\n", p.httpGetters, peer+p.basePath)
+		p.httpGetters[peer] = p.newGetter(peer)
+	}
+	p.logger.Infof("httppool | Set peers: %v", peers)
+	changes := ch.Changes(old, p.peers)
+	p.mu.Unlock()
+	p.notifyOwnership(changes)
+}
+
+// 加入新节点，已经有的节点忽略，它们的 httpGetter（连接、熔断器、健康状态）保持不变
+func (p *HTTPPool) AddPeers(peers ...string) {
+	p.mu.Lock()
+	if p.httpGetters == nil {
+		p.httpGetters = make(map[string]*httpGetter, len(peers))
+	}
+	var added []string
+	for _, peer := range peers {
+		if _, ok := p.httpGetters[peer]; !ok {
+			p.httpGetters[peer] = p.newGetter(peer)
+			added = append(added, peer)
+		}
+	}
+	p.logger.Infof("httppool | Add peers: %v", added)
+	changes := p.updateRing(nil, added)
+	p.mu.Unlock()
+	p.notifyOwnership(changes)
+}
+
+// 删除节点，不存在的节点忽略
+func (p *HTTPPool) RemovePeers(peers ...string) {
+	p.mu.Lock()
+	var removed []string
+	for _, peer := range peers {
+		if _, ok := p.httpGetters[peer]; ok {
+			delete(p.httpGetters, peer)
+			removed = append(removed, peer)
+		}
+	}
+	p.logger.Infof("httppool | Remove peers: %v", removed)
+	changes := p.updateRing(removed, nil)
+	p.mu.Unlock()
+	p.notifyOwnership(changes)
+}
+
+// 需要持有 p.mu
+func (p *HTTPPool) newGetter(peer string) *httpGetter {
+	getter := &httpGetter{
+		baseURL:     peer + p.basePath,
+		addr:        peer,
+		latency:     p.latency(peer),
+		logger:      p.logger,
+		client:      p.client,
+		timeout:     p.timeout,
+		fingerprint: p.fingerprint,
+	}
+	getter.raw.Store(p.rawFormat)
+	if p.breaker != nil {
+		getter.breaker = newBreaker(peer, *p.breaker)
+	}
+	return getter
+}
+
+// 节点的请求耗时直方图，第一次用到时创建，需要持有 p.mu
+func (p *HTTPPool) latency(peer string) *histogram {
+	h, ok := p.latencies[peer]
+	if !ok {
+		if p.latencies == nil {
+			p.latencies = make(map[string]*histogram)
+		}
+		h = newHistogram(defaultLatencyBuckets)
+		p.latencies[peer] = h
+	}
+	return h
+}
+
+// 在原来的哈希环上删除和加入节点，返回负责的节点发生变化的范围，需要持有 p.mu
+func (p *HTTPPool) updateRing(remove, add []string) []ch.Range {
+	if p.peers == nil {
+		p.peers = ch.New(p.replicas, p.hash)
+	}
+	if len(remove) == 0 && len(add) == 0 {
+		return nil
+	}
+	old := p.peers.Clone()
+	p.peers.Remove(remove...)
+	p.peers.Add(add...)
+	return ch.Changes(old, p.peers)
+}
+
+// 哈希环变化时调用 fn，changes是负责的节点发生变化的范围。
+// 可以用来把本节点不再负责的 key清掉，或者预热新负责的 key。
+// fn在修改哈希环的 goroutine里调用，调用时没有持有锁。需要在 Set之前调用
+func (p *HTTPPool) SetOwnershipListener(fn func(changes []ch.Range)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onOwnership = fn
+}
+
+// 不能持有 p.mu
+func (p *HTTPPool) notifyOwnership(changes []ch.Range) {
+	p.mu.Lock()
+	fn := p.onOwnership
+	p.mu.Unlock()
+	if fn != nil && len(changes) > 0 {
+		fn(changes)
 	}
 }
 
@@ -125,12 +384,39 @@ func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	// p.peers是哈希环
 	// 获取真实节点名称 peer，是远程节点，不能是本机 p.self
 	peer := p.peers.Get(key)
-	log.Printf("httppool | PickPeer: %v, %v", peer, p.self)
 	if peer != "" && peer != p.self {
-		p.Log("Pick peer: %s", peer)
+		p.logger.Debugf("[Server %s] Pick peer: %s", p.self, peer)
 		return p.httpGetters[peer], true // 返回真实节点的httpGetter客户端
 	}
 	return nil, false
 }
 
+// 返回除自身和 down的节点以外所有节点的 http客户端
+func (p *HTTPPool) ListPeers() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peers := make([]PeerGetter, 0, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if peer != p.self && !getter.health.down {
+			peers = append(peers, getter)
+		}
+	}
+	return peers
+}
+
+// 按地址排序的远程节点 httpGetter
+func (p *HTTPPool) sortedGetters() []*httpGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	getters := make([]*httpGetter, 0, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			getters = append(getters, getter)
+		}
+	}
+	sort.Slice(getters, func(i, j int) bool { return getters[i].addr < getters[j].addr })
+	return getters
+}
+
 var _ PeerPicker = (*HTTPPool)(nil)
+var _ PeerLister = (*HTTPPool)(nil)
@@ -0,0 +1,81 @@
+package geecache
+
+import (
+	"strconv"
+	"testing"
+
+	ch "module/consistenthash"
+)
+
+func TestAddRemovePeers(t *testing.T) {
+	self, a, b := "http://self", "http://a", "http://b"
+	p := NewHTTPPool(self)
+	var changes []ch.Range
+	p.SetOwnershipListener(func(c []ch.Range) { changes = c })
+	p.Set(self, a)
+	if len(changes) == 0 || changes[0].From != "" {
+		t.Fatalf("Set on an empty ring should report every range as new: %+v", changes)
+	}
+	getterA := p.httpGetters[a]
+
+	owners := func() map[string]string {
+		m := make(map[string]string)
+		for i := 0; i < 1000; i++ {
+			key := strconv.Itoa(i)
+			m[key] = p.peers.Get(key)
+		}
+		return m
+	}
+	before := owners()
+
+	changes = nil
+	p.AddPeers(a, b)
+	if p.httpGetters[a] != getterA {
+		t.Fatalf("AddPeers replaced the getter of an existing peer")
+	}
+	if len(changes) == 0 {
+		t.Fatalf("listener not called after AddPeers")
+	}
+	for _, r := range changes {
+		if r.To != b {
+			t.Fatalf("only ranges moving to the new peer should change: %+v", r)
+		}
+	}
+	after := owners()
+	moved := 0
+	for key, owner := range after {
+		if owner != before[key] {
+			if owner != b {
+				t.Fatalf("key %s moved from %s to %s", key, before[key], owner)
+			}
+			moved++
+		}
+	}
+	if moved == 0 {
+		t.Fatalf("new peer owns no keys")
+	}
+
+	changes = nil
+	p.AddPeers(a)
+	if changes != nil {
+		t.Fatalf("adding an existing peer should not change ownership: %+v", changes)
+	}
+
+	p.RemovePeers(b)
+	if _, ok := p.httpGetters[b]; ok {
+		t.Fatalf("getter of removed peer still present")
+	}
+	for _, r := range changes {
+		if r.From != b {
+			t.Fatalf("only ranges owned by the removed peer should change: %+v", r)
+		}
+	}
+	for key, owner := range owners() {
+		if owner != before[key] {
+			t.Fatalf("key %s owned by %s after removing b, want %s", key, owner, before[key])
+		}
+	}
+	if p.httpGetters[a] != getterA {
+		t.Fatalf("RemovePeers replaced the getter of a remaining peer")
+	}
+}
@@ -0,0 +1,63 @@
+package geecache
+
+import (
+	"fmt"
+	"log"
+)
+
+// 日志级别，低于设定级别的日志不会输出
+type Level int
+
+const (
+	LevelDebug Level = iota // 缓存命中、每个请求的细节，只在排查问题时打开
+	LevelInfo               // 节点变化等不频繁的事件
+	LevelError              // 远程节点或者数据源出错
+)
+
+// Group和 HTTPPool使用的日志接口，默认不输出任何日志。
+// 可以自己实现，对接项目里已有的日志库
+type Logger interface {
+	Debugf(format string, v ...interface{})
+	Infof(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+}
+
+// 什么都不做的 Logger，作为库使用时的默认值
+type noopLogger struct{}
+
+func (noopLogger) Debugf(format string, v ...interface{}) {}
+func (noopLogger) Infof(format string, v ...interface{})  {}
+func (noopLogger) Errorf(format string, v ...interface{}) {}
+
+// 基于标准库 log.Logger的实现
+type stdLogger struct {
+	l     *log.Logger
+	level Level
+}
+
+// 用 log.Logger输出不低于 level的日志，l为 nil时使用 log.Default()
+func NewStdLogger(l *log.Logger, level Level) Logger {
+	if l == nil {
+		l = log.Default()
+	}
+	return &stdLogger{l: l, level: level}
+}
+
+func (s *stdLogger) output(level Level, prefix string, format string, v ...interface{}) {
+	if level < s.level {
+		return
+	}
+	s.l.Output(3, prefix+fmt.Sprintf(format, v...))
+}
+
+func (s *stdLogger) Debugf(format string, v ...interface{}) {
+	s.output(LevelDebug, "[DEBUG] ", format, v...)
+}
+
+func (s *stdLogger) Infof(format string, v ...interface{}) {
+	s.output(LevelInfo, "[INFO] ", format, v...)
+}
+
+func (s *stdLogger) Errorf(format string, v ...interface{}) {
+	s.output(LevelError, "[ERROR] ", format, v...)
+}
@@ -0,0 +1,49 @@
+package geecache
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestStdLoggerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0), LevelInfo)
+	l.Debugf("debug %d", 1)
+	l.Infof("info %d", 2)
+	l.Errorf("error %d", 3)
+	if got, want := buf.String(), "[INFO] info 2\n[ERROR] error 3\n"; got != want {
+		t.Fatalf("output = %q, want %q", got, want)
+	}
+}
+
+// 默认的 noopLogger不输出任何东西，打开 Debug日志后同样的 Get会输出
+func TestDefaultLoggerSilent(t *testing.T) {
+	var buf bytes.Buffer
+	old := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(old)
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		if key == "bad" {
+			return nil, errors.New("db down")
+		}
+		return []byte(key), nil
+	})
+
+	g := NewGroup("logger-silent", 1<<20, getter)
+	g.Get("k")
+	g.Get("k")
+	g.Get("bad")
+	if buf.Len() != 0 {
+		t.Fatalf("default logger wrote %q", buf.String())
+	}
+
+	g = NewGroup("logger-debug", 1<<20, getter, WithLogger(NewStdLogger(nil, LevelDebug)))
+	g.Get("k")
+	g.Get("k")
+	if !strings.Contains(buf.String(), "[DEBUG]") {
+		t.Fatalf("debug logger wrote %q, want [DEBUG] lines", buf.String())
+	}
+}
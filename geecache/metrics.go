@@ -0,0 +1,211 @@
+package geecache
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 只用标准库输出 Prometheus text format (version 0.0.4)，不引入额外依赖
+
+// 远程节点请求耗时的分桶上界，单位秒
+var defaultLatencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// 简单的直方图，counts[i]是落在 (buckets[i-1], buckets[i]]里的个数，最后一个是 +Inf
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)+1),
+	}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	v := d.Seconds()
+	i := sort.SearchFloat64s(h.buckets, v) // 第一个 >= v的上界
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+// 按 Prometheus的约定输出累加的 _bucket、_sum和 _count
+func (h *histogram) write(w *bufio.Writer, name string, labels string) {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	sum, count := h.sum, h.count
+	h.mu.Unlock()
+
+	var cumulative uint64
+	for i, upper := range h.buckets {
+		cumulative += counts[i]
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(upper), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, count)
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(sum))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, count)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func label(name, value string) string {
+	return name + `="` + labelEscaper.Replace(value) + `"`
+}
+
+// 一个指标的所有样本
+type metric struct {
+	name  string
+	help  string
+	typ   string // counter 或 gauge
+	value func(g *Group, s Stats) int64
+}
+
+var groupMetrics = []metric{
+	{"geecache_gets_total", "Get requests, including requests from peers.", "counter",
+		func(g *Group, s Stats) int64 { return s.Gets }},
+	{"geecache_hits_total", "Get requests served from the main or hot cache.", "counter",
+		func(g *Group, s Stats) int64 { return s.LocalHits }},
+	{"geecache_negative_hits_total", "Get requests answered from the negative cache.", "counter",
+		func(g *Group, s Stats) int64 { return s.NegativeHits }},
+	{"geecache_stale_hits_total", "Get requests served a stale value while it is refreshed.", "counter",
+		func(g *Group, s Stats) int64 { return s.StaleHits }},
+	{"geecache_refreshes_total", "Background refreshes of stale or soon expiring values.", "counter",
+		func(g *Group, s Stats) int64 { return s.Refreshes }},
+	{"geecache_refresh_errors_total", "Failed background refreshes.", "counter",
+		func(g *Group, s Stats) int64 { return s.RefreshErrors }},
+	{"geecache_misses_total", "Get requests that were not served from a local or negative cache.", "counter",
+		func(g *Group, s Stats) int64 { return s.Gets - s.LocalHits - s.NegativeHits }},
+	{"geecache_peer_loads_total", "Values successfully loaded from a peer.", "counter",
+		func(g *Group, s Stats) int64 { return s.PeerLoads }},
+	{"geecache_peer_errors_total", "Failed loads from a peer.", "counter",
+		func(g *Group, s Stats) int64 { return s.PeerErrors }},
+	{"geecache_getter_loads_total", "Values successfully loaded from the Getter.", "counter",
+		func(g *Group, s Stats) int64 { return s.GetterLoads }},
+	{"geecache_getter_errors_total", "Failed loads from the Getter.", "counter",
+		func(g *Group, s Stats) int64 { return s.GetterErrors }},
+	{"geecache_loads_deduped_total", "Loads that shared the result of a concurrent load.", "counter",
+		func(g *Group, s Stats) int64 { return s.LoadsDeduped }},
+	{"geecache_server_requests_total", "Requests from peers served over HTTP.", "counter",
+		func(g *Group, s Stats) int64 { return s.ServerRequests }},
+	{"geecache_loads_in_flight", "Loads currently running in singleflight.", "gauge",
+		func(g *Group, s Stats) int64 { return int64(g.loader.InFlight()) }},
+}
+
+// 每个 Group的 mainCache和 hotCache都有的指标
+type cacheMetric struct {
+	name  string
+	help  string
+	typ   string
+	value func(s CacheStats) int64
+}
+
+var cacheMetrics = []cacheMetric{
+	{"geecache_cache_bytes", "Bytes of keys and values in the cache.", "gauge",
+		func(s CacheStats) int64 { return s.Bytes }},
+	{"geecache_cache_heap_bytes", "Estimated heap bytes used by the cache, including per-entry overhead.", "gauge",
+		func(s CacheStats) int64 { return s.HeapBytes }},
+	{"geecache_cache_items", "Items in the cache.", "gauge",
+		func(s CacheStats) int64 { return s.Items }},
+	{"geecache_cache_gets_total", "Lookups in the cache.", "counter",
+		func(s CacheStats) int64 { return s.Gets }},
+	{"geecache_cache_hits_total", "Lookups that hit the cache.", "counter",
+		func(s CacheStats) int64 { return s.Hits }},
+	{"geecache_cache_evictions_total", "Items evicted for size or expiry.", "counter",
+		func(s CacheStats) int64 { return s.Evictions }},
+}
+
+// 按名字排序，保证输出稳定
+func sortedGroups() []*Group {
+	mu.RLock()
+	defer mu.RUnlock()
+	gs := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		gs = append(gs, g)
+	}
+	sort.Slice(gs, func(i, j int) bool { return gs[i].name < gs[j].name })
+	return gs
+}
+
+// 所有节点的请求耗时，按地址排序，包括已经删除的节点
+func (p *HTTPPool) sortedLatencies() ([]string, []*histogram) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peers := make([]string, 0, len(p.latencies))
+	for peer := range p.latencies {
+		if peer != p.self {
+			peers = append(peers, peer)
+		}
+	}
+	sort.Strings(peers)
+	latencies := make([]*histogram, len(peers))
+	for i, peer := range peers {
+		latencies[i] = p.latencies[peer]
+	}
+	return peers, latencies
+}
+
+// 返回输出 Prometheus指标的 http.Handler，一般挂在 /metrics，和 HTTPPool用同一个 mux：
+//
+//	mux.Handle("/metrics", pool.MetricsHandler())
+//	mux.Handle("/_geecache/", pool)
+func (p *HTTPPool) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w := bufio.NewWriter(rw)
+		defer w.Flush()
+
+		gs := sortedGroups()
+		stats := make([]Stats, len(gs))
+		for i, g := range gs {
+			stats[i] = g.Stats()
+		}
+
+		for _, m := range groupMetrics {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+			for i, g := range gs {
+				fmt.Fprintf(w, "%s{%s} %d\n", m.name, label("group", g.name), m.value(g, stats[i]))
+			}
+		}
+		for _, m := range cacheMetrics {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+			for i, g := range gs {
+				fmt.Fprintf(w, "%s{%s,cache=\"main\"} %d\n", m.name, label("group", g.name), m.value(stats[i].MainCache))
+				fmt.Fprintf(w, "%s{%s,cache=\"hot\"} %d\n", m.name, label("group", g.name), m.value(stats[i].HotCache))
+				fmt.Fprintf(w, "%s{%s,cache=\"negative\"} %d\n", m.name, label("group", g.name), m.value(stats[i].NegativeCache))
+			}
+		}
+
+		fmt.Fprintf(w, "# HELP geecache_peer_up Whether the peer passed its health checks.\n# TYPE geecache_peer_up gauge\n")
+		for _, st := range p.PeerStates() {
+			up := 0
+			if st.Up {
+				up = 1
+			}
+			fmt.Fprintf(w, "geecache_peer_up{%s} %d\n", label("peer", st.Addr), up)
+		}
+
+		const name = "geecache_peer_request_duration_seconds"
+		fmt.Fprintf(w, "# HELP %s Latency of requests to peers.\n# TYPE %s histogram\n", name, name)
+		peers, latencies := p.sortedLatencies()
+		for i, peer := range peers {
+			latencies[i].write(w, name, label("peer", peer))
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package geecache
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, p *HTTPPool) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	p.MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	body, _ := ioutil.ReadAll(w.Body)
+	return string(body)
+}
+
+func TestMetricsHandler(t *testing.T) {
+	g := NewGroup("metrics-test", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v"), nil
+	}))
+	g.Get("k")
+	g.Get("k")
+	srv := httptest.NewServer(NewHTTPPool("http://peer"))
+	defer srv.Close()
+	p := NewHTTPPool("http://self")
+	p.Set("http://self", srv.URL)
+	p.httpGetters[srv.URL].getView(context.Background(), "metrics-test", "k")
+
+	out := scrape(t, p)
+	peer := `peer="` + srv.URL + `"`
+	for _, want := range []string{
+		"# TYPE geecache_gets_total counter\n",
+		`geecache_gets_total{group="metrics-test"} 3` + "\n", // 加上远程节点请求的那一次
+		`geecache_hits_total{group="metrics-test"} 2` + "\n",
+		`geecache_cache_items{group="metrics-test",cache="main"} 1` + "\n",
+		`geecache_server_requests_total{group="metrics-test"} 1` + "\n",
+		"geecache_peer_up{" + peer + "} 1\n",
+		"# TYPE geecache_peer_request_duration_seconds histogram\n",
+		"geecache_peer_request_duration_seconds_bucket{" + peer + `,le="+Inf"} 1` + "\n",
+		"geecache_peer_request_duration_seconds_count{" + peer + "} 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+	if strings.Contains(out, `peer="http://self"`) {
+		t.Errorf("metrics output contains self")
+	}
+
+	// 节点变化之后计数器不能变小
+	p.RemovePeers(srv.URL)
+	p.AddPeers(srv.URL)
+	p.Set("http://self", srv.URL)
+	if out := scrape(t, p); !strings.Contains(out, "geecache_peer_request_duration_seconds_count{"+peer+"} 1\n") {
+		t.Fatalf("latency histogram reset after membership changes")
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	if got := label("group", "a\"b\\c\nd"); got != `group="a\"b\\c\nd"` {
+		t.Fatalf("label = %s", got)
+	}
+}
@@ -0,0 +1,96 @@
+package geecache
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNegativeCache(t *testing.T) {
+	var loads atomic.Int64
+	g := NewGroup("negative-local", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}), WithNegativeCache(20*time.Millisecond, 1<<20))
+
+	for i := 0; i < 3; i++ {
+		if _, err := g.Get("missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get err = %v, want ErrNotFound", err)
+		}
+	}
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("getter called %d times, want 1", n)
+	}
+	if n := g.Stats().NegativeHits; n != 2 {
+		t.Fatalf("NegativeHits = %d, want 2", n)
+	}
+	if n := g.CacheStats(NegativeCache).Items; n != 1 {
+		t.Fatalf("negative cache has %d items, want 1", n)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	g.Get("missing")
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("expired negative entry not reloaded, getter called %d times", n)
+	}
+
+	// 其他错误不缓存
+	g2 := NewGroup("negative-other", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		return nil, errors.New("db is down")
+	}), WithNegativeCache(time.Minute, 1<<20))
+	g2.Get("k")
+	g2.Get("k")
+	if n := g2.Stats().NegativeHits; n != 0 {
+		t.Fatalf("non-ErrNotFound error was cached")
+	}
+}
+
+type notFoundPeer struct {
+	gets atomic.Int64
+}
+
+func (p *notFoundPeer) Get(group string, key string) ([]byte, error) {
+	p.gets.Add(1)
+	return nil, &PeerError{Status: 404, Code: codeNotFound, Msg: key}
+}
+
+// 远程节点确认不存在的 key，本节点不再去数据源查，也记在负缓存里
+func TestNegativeCachePeer(t *testing.T) {
+	peer := &notFoundPeer{}
+	g := NewGroup("negative-peer", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		t.Errorf("key confirmed missing by the peer loaded locally")
+		return nil, ErrNotFound
+	}), WithNegativeCache(time.Minute, 1<<20))
+	g.RegisterPeers(fakePicker{peer})
+
+	for i := 0; i < 2; i++ {
+		if _, err := g.Get("pk"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get err = %v, want ErrNotFound", err)
+		}
+	}
+	if n := peer.gets.Load(); n != 1 {
+		t.Fatalf("peer called %d times, want 1", n)
+	}
+	if n := g.Stats().NegativeHits; n != 1 {
+		t.Fatalf("NegativeHits = %d, want 1", n)
+	}
+}
+
+func TestNegativeCacheInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		ttl   time.Duration
+		bytes int64
+	}{{time.Second, 0}, {0, 1 << 20}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("WithNegativeCache(%v, %d) should panic", tt.ttl, tt.bytes)
+				}
+			}()
+			WithNegativeCache(tt.ttl, tt.bytes)
+		}()
+	}
+}
@@ -0,0 +1,91 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	ch "module/consistenthash"
+	"net/http"
+	"strings"
+)
+
+// 请求头里带上发送方的配置指纹，接收方的指纹不一样时返回 409，
+// 一致性哈希的参数不一样的节点会把同一个 key路由到不同的节点，缓存就乱了
+const configHeader = "X-Geecache-Config"
+
+// 没有调用 WithHash时，consistenthash默认用 crc32.ChecksumIEEE
+const defaultHashName = "crc32"
+
+// NewHTTPPool的可选配置
+type HTTPPoolOption func(*HTTPPool)
+
+// 节点间通讯地址的前缀，默认是 defaultBasePath。
+// 同一个 mux上跑两个缓存集群时，给它们不同的前缀
+func WithBasePath(path string) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		if !strings.HasSuffix(path, "/") {
+			path += "/"
+		}
+		p.basePath = path
+	}
+}
+
+// 每个节点在哈希环上的虚拟节点个数，默认是 defaultReplicas。n必须大于 0，否则哈希环是空的
+func WithReplicas(n int) HTTPPoolOption {
+	if n <= 0 {
+		panic("WithReplicas: replicas must be positive")
+	}
+	return func(p *HTTPPool) {
+		p.replicas = n
+	}
+}
+
+// 一致性哈希用的哈希函数。函数没法跨进程比较，
+// name用来算配置指纹，同一个集群的节点要用同样的函数和名字。
+// fn不能是 nil，否则 consistenthash会换成 crc32，和 name对不上
+func WithHash(name string, fn ch.Hash) HTTPPoolOption {
+	if name == "" || fn == nil {
+		panic("WithHash: name and fn are required")
+	}
+	return func(p *HTTPPool) {
+		p.hashName, p.hash = name, fn
+	}
+}
+
+// 影响 key路由的配置的指纹，同一个集群里的节点必须一样
+func (p *HTTPPool) Fingerprint() string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s|%d|%s", p.basePath, p.replicas, p.hashName)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// 检查请求方的配置指纹，旧节点不带这个请求头，不检查。
+// 二进制格式的请求用二进制格式返回错误
+func (p *HTTPPool) checkFingerprint(w http.ResponseWriter, r *http.Request) bool {
+	theirs := r.Header.Get(configHeader)
+	if theirs == "" || theirs == p.fingerprint {
+		return true
+	}
+	p.logger.Errorf("[Server %s] config fingerprint %s from %s does not match ours %s", p.self, theirs, r.RemoteAddr, p.fingerprint)
+	err := fmt.Errorf("%w: peer has %s, we have %s", ErrConfigMismatch, theirs, p.fingerprint)
+	if r.Header.Get("Content-Type") == WireContentType {
+		writeWireError(w, err)
+	} else {
+		writeError(w, err)
+	}
+	return false
+}
+
+// 创建发给远程节点的请求，带上配置指纹
+func (h *httpGetter) newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(configHeader, h.fingerprint)
+	return req, nil
+}
@@ -0,0 +1,81 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func fnv32(data []byte) uint32 {
+	h := fnv.New32a()
+	h.Write(data)
+	return h.Sum32()
+}
+
+func TestHTTPPoolOptions(t *testing.T) {
+	// 同一个 mux上的两个集群，用不同的前缀
+	a := NewHTTPPool("http://self", WithBasePath("cluster-a"))
+	b := NewHTTPPool("http://self", WithBasePath("/cluster-b/"), WithReplicas(10), WithHash("fnv32a", fnv32))
+	mux := http.NewServeMux()
+	mux.Handle("/cluster-a/", a)
+	mux.Handle("/cluster-b/", b)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	if a.basePath != "/cluster-a/" || b.basePath != "/cluster-b/" {
+		t.Fatalf("base paths = %q, %q", a.basePath, b.basePath)
+	}
+	if a.Fingerprint() == b.Fingerprint() {
+		t.Fatalf("different configs should have different fingerprints")
+	}
+
+	// 配置一样的节点可以互相访问
+	a2 := NewHTTPPool("http://other", WithBasePath("/cluster-a/"))
+	a2.Set(srv.URL)
+	if err := a2.httpGetters[srv.URL].probe(time.Second); err != nil {
+		t.Fatalf("probe with matching config: %v", err)
+	}
+
+	// 虚拟节点个数不一样，请求被拒绝
+	bad := NewHTTPPool("http://other", WithBasePath("/cluster-b/"))
+	bad.Set(srv.URL)
+	if err := bad.httpGetters[srv.URL].Remove("scores", "Tom"); !errors.Is(err, ErrConfigMismatch) {
+		t.Fatalf("err = %v, want ErrConfigMismatch", err)
+	}
+	if err := bad.httpGetters[srv.URL].probe(time.Second); err == nil {
+		t.Fatalf("probe with mismatched config should fail")
+	}
+	// 默认的二进制格式也要检查
+	getter := bad.httpGetters[srv.URL]
+	if _, err := getter.getView(context.Background(), "scores", "Tom"); !errors.Is(err, ErrConfigMismatch) {
+		t.Fatalf("wire err = %v, want ErrConfigMismatch", err)
+	}
+	if getter.raw.Load() {
+		t.Fatalf("config mismatch should not switch the getter to raw format")
+	}
+}
+
+func TestHTTPPoolOptionsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  func() HTTPPoolOption
+	}{
+		{"zero replicas", func() HTTPPoolOption { return WithReplicas(0) }},
+		{"nil hash", func() HTTPPoolOption { return WithHash("fnv32a", nil) }},
+		{"empty hash name", func() HTTPPoolOption { return WithHash("", fnv32) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("invalid option should panic")
+				}
+			}()
+			NewHTTPPool("http://self", tt.opt())
+		})
+	}
+}
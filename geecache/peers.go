@@ -1,5 +1,7 @@
 package geecache
 
+import "context"
+
 // 根据传入的 key选择相应的节点 PeerGetter
 type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
@@ -9,3 +11,29 @@ type PeerPicker interface {
 type PeerGetter interface {
 	Get(group string, key string) ([]byte, error)
 }
+
+// 带 context的 PeerGetter，ctx被取消时放弃请求
+type ContextPeerGetter interface {
+	GetContext(ctx context.Context, group string, key string) ([]byte, error)
+}
+
+// 一次请求获取同一个节点上的多个 key。
+// 返回的 map里没有的 key，表示获取失败
+type BatchPeerGetter interface {
+	GetMulti(ctx context.Context, group string, keys []string) (map[string][]byte, error)
+}
+
+// 通知相应节点删除 group中的缓存值
+type PeerRemover interface {
+	Remove(group string, key string) error
+}
+
+// 列出除自身以外的所有节点，用于广播删除
+type PeerLister interface {
+	ListPeers() []PeerGetter
+}
+
+// 包内部使用，返回带有过期时间等元数据的 ByteView，httpGetter实现了这个接口
+type viewGetter interface {
+	getView(ctx context.Context, group string, key string) (ByteView, error)
+}
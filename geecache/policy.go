@@ -0,0 +1,141 @@
+package geecache
+
+import (
+	"fmt"
+	"module/arc"
+	"module/clock"
+	"module/lfu"
+	"module/lru"
+	"module/sieve"
+	"module/tinylfu"
+	"time"
+)
+
+// 缓存的淘汰算法，通过 WithPolicy给每个 Group选择
+type Policy int
+
+const (
+	PolicyLRU     Policy = iota // 最近最少使用，默认
+	PolicyLFU                   // 最不经常使用，访问频率会定期衰减
+	PolicyARC                   // 自适应替换，在最近访问和经常访问之间自动调整，不怕一次性扫描
+	PolicyTinyLFU               // LRU前面加 TinyLFU准入，只访问一次的值不会挤掉热点
+	PolicySIEVE                 // 命中只设置访问标记，get只需要读锁
+	PolicyCLOCK                 // LRU的近似，和 SIEVE一样 get只需要读锁
+)
+
+func (p Policy) String() string {
+	switch p {
+	case PolicyLRU:
+		return "lru"
+	case PolicyLFU:
+		return "lfu"
+	case PolicyARC:
+		return "arc"
+	case PolicyTinyLFU:
+		return "tinylfu"
+	case PolicySIEVE:
+		return "sieve"
+	case PolicyCLOCK:
+		return "clock"
+	}
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+// cache用到的淘汰算法的方法，lru、lfu、arc、tinylfu、sieve、clock包里的 Cache都实现了。
+// 不是并发安全的，由 cache加锁
+type evictor interface {
+	Get(key string) (ByteView, bool)
+	AddWithTTL(key string, value ByteView, ttl time.Duration)
+	Remove(key string)
+	Len() int
+	Bytes() int64
+	Evictions() int64
+}
+
+// arc和 tinylfu除了缓存的节点，还有 ghost链表、sketch这些内存，由 HeapBytes报告
+type heapReporter interface {
+	HeapBytes() int64
+}
+
+var (
+	_ evictor = (*lru.Cache[string, ByteView])(nil)
+	_ evictor = (*lfu.Cache[string, ByteView])(nil)
+	_ evictor = (*arc.Cache[string, ByteView])(nil)
+	_ evictor = (*tinylfu.Cache[string, ByteView])(nil)
+	_ evictor = (*sieve.Cache[string, ByteView])(nil)
+	_ evictor = (*clock.Cache[string, ByteView])(nil)
+
+	_ heapReporter = (*arc.Cache[string, ByteView])(nil)
+	_ heapReporter = (*tinylfu.Cache[string, ByteView])(nil)
+)
+
+func (p Policy) newEvictor(maxBytes int64) evictor {
+	size := p.sizeFunc()
+	switch p {
+	case PolicyLFU:
+		return lfu.NewCache(maxBytes, size)
+	case PolicyARC:
+		return arc.NewCache(maxBytes, size)
+	case PolicyTinyLFU:
+		return tinylfu.NewCache(maxBytes, sketchCounters(maxBytes), size, tinylfu.StringHash)
+	case PolicySIEVE:
+		return sieve.NewCache(maxBytes, size)
+	case PolicyCLOCK:
+		return clock.NewCache(maxBytes, size)
+	default:
+		return lru.NewCache(maxBytes, size)
+	}
+}
+
+// Get是否只读（只原子地设置访问标记），是的话 cache.get只需要读锁
+func (p Policy) readOnlyGet() bool {
+	return p == PolicySIEVE || p == PolicyCLOCK
+}
+
+// 不知道每个值有多大，按平均 256字节估计缓存里有多少个 key
+func sketchCounters(maxBytes int64) int {
+	const avgEntryBytes, minCounters, maxCounters = 256, 64, 1 << 20
+	n := maxBytes / avgEntryBytes
+	switch {
+	case maxBytes == 0 || n > maxCounters: // 0表示不限制
+		return maxCounters
+	case n < minCounters:
+		return minCounters
+	}
+	return int(n)
+}
+
+// 每个缓存值除了 key和值本身，淘汰算法的节点在堆上额外占用的内存，由各个包按自己的节点结构估计。
+// 值很小的时候这部分比值本身大得多，不算进去的话实际内存会是 cacheBytes的好几倍，
+// TestHeapBytes用 runtime.MemStats检查这个估计
+func (p Policy) entryOverhead() int64 {
+	switch p {
+	case PolicyLFU:
+		return lfu.EntryOverhead[string, ByteView]()
+	case PolicyARC:
+		return arc.EntryOverhead[string, ByteView]()
+	case PolicyTinyLFU:
+		return tinylfu.EntryOverhead[string, ByteView]()
+	case PolicySIEVE:
+		return sieve.EntryOverhead[string, ByteView]()
+	case PolicyCLOCK:
+		return clock.EntryOverhead[string, ByteView]()
+	default:
+		return lru.EntryOverhead[string, ByteView]()
+	}
+}
+
+// key和值的长度，加上节点的开销，cacheBytes限制的是估计的堆内存
+func (p Policy) sizeFunc() func(key string, value ByteView) int64 {
+	overhead := p.entryOverhead()
+	return func(key string, value ByteView) int64 {
+		return int64(len(key)) + int64(value.Len()) + overhead
+	}
+}
+
+// mainCache使用的淘汰算法，hotCache和负缓存总是用 LRU
+func WithPolicy(p Policy) GroupOption {
+	return func(g *Group) {
+		g.policy = p
+	}
+}
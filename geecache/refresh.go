@@ -0,0 +1,135 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const defaultMaxRefreshes = 8
+
+// 过期策略，需要配合 WithTTL使用
+type RefreshPolicy struct {
+	// 过期之后，在 StaleFor内还会返回旧的值，同时在后台重新加载（stale-while-revalidate）。
+	// 0表示过期后直接删除，下一次 Get同步加载
+	StaleFor time.Duration
+	// 剩余寿命不到 TTL的这个比例时被访问，就在后台提前重新加载（refresh-ahead），比如 0.2。
+	// 0表示不提前加载
+	RefreshAhead float64
+	// 同时进行的后台加载最多有多少个，超过的直接跳过。默认 defaultMaxRefreshes
+	MaxConcurrent int
+}
+
+// 设置 Group的过期策略，热点 key过期时不会卡住请求
+func WithRefreshPolicy(p RefreshPolicy) GroupOption {
+	return func(g *Group) {
+		if p.MaxConcurrent <= 0 {
+			p.MaxConcurrent = defaultMaxRefreshes
+		}
+		g.refresh = refresher{
+			policy:     p,
+			sem:        make(chan struct{}, p.MaxConcurrent),
+			refreshing: make(map[string]*refreshState),
+		}
+	}
+}
+
+// 管理后台刷新
+type refresher struct {
+	policy     RefreshPolicy
+	sem        chan struct{} // 限制同时进行的后台加载个数，nil表示没有设置过期策略
+	mu         sync.Mutex
+	refreshing map[string]*refreshState // 正在后台刷新的 key
+}
+
+type refreshState struct {
+	removed bool // 刷新期间 key被 Remove了，加载到的值可能是删除之前的，不能再放进缓存
+}
+
+// Remove时调用，正在刷新的 key的结果作废
+func (r *refresher) markRemoved(key string) {
+	if r.sem == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if st, ok := r.refreshing[key]; ok {
+		st.removed = true
+	}
+}
+
+// mainCache命中后检查值是否需要刷新：
+// 已经过期（还在 StaleFor内）或者剩余寿命不到 RefreshAhead * ttl
+func (g *Group) maybeRefresh(key string, v ByteView) {
+	if g.refresh.sem == nil || v.e.IsZero() {
+		return
+	}
+	left := time.Until(v.e)
+	switch {
+	case left <= 0:
+		g.stats.staleHits.Add(1)
+		g.logger.Debugf("geecache | serve stale value: %v", key)
+	case left < time.Duration(g.refresh.policy.RefreshAhead*float64(g.ttl)):
+	default:
+		return
+	}
+	g.backgroundRefresh(key)
+}
+
+// 在后台重新加载 key，和前台的加载一样通过 singleflight去重。
+// 同一个 key同时只有一个后台刷新，超过 MaxConcurrent时直接跳过
+func (g *Group) backgroundRefresh(key string) {
+	r := &g.refresh
+	r.mu.Lock()
+	if _, ok := r.refreshing[key]; ok {
+		r.mu.Unlock()
+		return
+	}
+	select {
+	case r.sem <- struct{}{}:
+	default:
+		r.mu.Unlock()
+		return
+	}
+	st := &refreshState{}
+	r.refreshing[key] = st
+	r.mu.Unlock()
+
+	go func() {
+		defer func() {
+			r.mu.Lock()
+			delete(r.refreshing, key)
+			r.mu.Unlock()
+			<-r.sem
+		}()
+		g.stats.refreshes.Add(1)
+		viewi, err, _ := g.loader.DoContext(context.Background(), key, g.loadFunc(key))
+
+		r.mu.Lock()
+		removed := st.removed
+		r.mu.Unlock()
+		if removed { // getLocally可能已经把值放回 mainCache了，再删一次
+			g.mainCache.remove(key)
+			g.hotCache.remove(key)
+			return
+		}
+		if err == nil {
+			// 本节点负责的 key，getLocally已经替换掉旧的值了。
+			// 远程节点负责的 key（比如之前远程节点失败、回退到本地加载的），
+			// 旧的值从 mainCache里删掉，新的值放进 hotCache
+			if g.peers != nil {
+				if _, ok := g.peers.PickPeer(key); ok {
+					g.mainCache.remove(key)
+					g.addHot(key, viewi.(ByteView))
+				}
+			}
+			return
+		}
+		g.stats.refreshErrors.Add(1)
+		g.logger.Errorf("geecache | refresh %v failed: %v", key, err)
+		if errors.Is(err, ErrNotFound) { // 数据源里已经没有了，旧的值也不能再用
+			g.mainCache.remove(key)
+		}
+	}()
+}
@@ -0,0 +1,148 @@
+package geecache
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 等后台刷新都结束
+func waitRefresh(t *testing.T, g *Group) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		g.refresh.mu.Lock()
+		n := len(g.refresh.refreshing)
+		g.refresh.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("background refresh did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// 每次加载返回的版本号加一
+func versionGetter(version *atomic.Int64) Getter {
+	return GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key + strconv.FormatInt(version.Add(1), 10)), nil
+	})
+}
+
+func TestRefreshStale(t *testing.T) {
+	var version atomic.Int64
+	g := NewGroup("refresh-stale", 1<<20, versionGetter(&version),
+		WithTTL(20*time.Millisecond), WithRefreshPolicy(RefreshPolicy{StaleFor: time.Minute}))
+	if v, _ := g.Get("k"); v.String() != "k1" {
+		t.Fatalf("Get = %q, want k1", v.String())
+	}
+	time.Sleep(30 * time.Millisecond)
+	if v, _ := g.Get("k"); v.String() != "k1" {
+		t.Fatalf("expired Get = %q, want stale k1", v.String())
+	}
+	waitRefresh(t, g)
+	if v, _ := g.Get("k"); v.String() != "k2" {
+		t.Fatalf("Get after refresh = %q, want k2", v.String())
+	}
+	if st := g.Stats(); st.StaleHits != 1 || st.Refreshes != 1 {
+		t.Fatalf("StaleHits = %d, Refreshes = %d, want 1, 1", st.StaleHits, st.Refreshes)
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	var version atomic.Int64
+	g := NewGroup("refresh-ahead", 1<<20, versionGetter(&version),
+		WithTTL(100*time.Millisecond), WithRefreshPolicy(RefreshPolicy{RefreshAhead: 0.5}))
+	g.Get("k")
+	g.Get("k") // 剩余寿命还很长，不刷新
+	waitRefresh(t, g)
+	if n := g.Stats().Refreshes; n != 0 {
+		t.Fatalf("fresh value refreshed %d times", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if v, _ := g.Get("k"); v.String() != "k1" {
+		t.Fatalf("Get = %q, want k1 while refreshing ahead", v.String())
+	}
+	waitRefresh(t, g)
+	if v, _ := g.Get("k"); v.String() != "k2" {
+		t.Fatalf("Get after refresh = %q, want k2", v.String())
+	}
+}
+
+func TestRefreshMaxConcurrent(t *testing.T) {
+	release := make(chan struct{})
+	var loads atomic.Int64
+	g := NewGroup("refresh-max", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		if loads.Add(1) > 2 { // 前两次是前台加载
+			<-release
+		}
+		return []byte(key), nil
+	}), WithTTL(10*time.Millisecond), WithRefreshPolicy(RefreshPolicy{StaleFor: time.Minute, MaxConcurrent: 1}))
+	g.Get("a")
+	g.Get("b")
+	time.Sleep(20 * time.Millisecond)
+	g.Get("a") // 开始刷新 a，卡住
+	g.Get("a") // 已经在刷新
+	g.Get("b") // 超过 MaxConcurrent，跳过
+	close(release)
+	waitRefresh(t, g)
+	if n := g.Stats().Refreshes; n != 1 {
+		t.Fatalf("Refreshes = %d, want 1", n)
+	}
+}
+
+// 刷新期间 Remove，刷新的结果不能再放回缓存
+func TestRefreshRemoved(t *testing.T) {
+	var version atomic.Int64
+	started, release := make(chan struct{}), make(chan struct{})
+	g := NewGroup("refresh-removed", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		n := version.Add(1)
+		if n == 2 {
+			close(started)
+			<-release
+		}
+		return []byte(key + strconv.FormatInt(n, 10)), nil
+	}), WithTTL(10*time.Millisecond), WithRefreshPolicy(RefreshPolicy{StaleFor: time.Minute}))
+	g.Get("k")
+	time.Sleep(20 * time.Millisecond)
+	g.Get("k")
+	<-started
+	g.Remove("k")
+	close(release)
+	waitRefresh(t, g)
+	if _, ok := g.mainCache.get("k"); ok {
+		t.Fatalf("refresh wrote a removed key back to mainCache")
+	}
+	if v, _ := g.Get("k"); v.String() != "k3" {
+		t.Fatalf("Get after Remove = %q, want k3", v.String())
+	}
+}
+
+type valuePeer struct{}
+
+func (valuePeer) Get(group string, key string) ([]byte, error) {
+	return []byte("peer-" + key), nil
+}
+
+// 远程节点负责的 key，刷新后放进 hotCache而不是 mainCache
+func TestRefreshPeerOwned(t *testing.T) {
+	g := NewGroup("refresh-peer", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local-" + key), nil
+	}), WithTTL(time.Minute), WithRefreshPolicy(RefreshPolicy{StaleFor: time.Minute}), WithHotCache(1<<20, 0.01, 0))
+	g.RegisterPeers(fakePicker{valuePeer{}})
+	// 之前远程节点失败，回退到本地加载的旧值
+	g.mainCache.add("pk", ByteView{b: []byte("old"), e: time.Now().Add(-time.Second)})
+	if v, _ := g.Get("pk"); v.String() != "old" {
+		t.Fatalf("Get = %q, want stale old", v.String())
+	}
+	waitRefresh(t, g)
+	if _, ok := g.mainCache.get("pk"); ok {
+		t.Fatalf("peer-owned key still in mainCache after refresh")
+	}
+	if v, ok := g.hotCache.get("pk"); !ok || v.String() != "peer-pk" {
+		t.Fatalf("hotCache = %q, %v, want peer-pk", v.String(), ok)
+	}
+}
@@ -0,0 +1,127 @@
+package geecache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// 记录收到的删除请求
+type removePeer struct {
+	name    string
+	mu      *sync.Mutex
+	removed *[]string
+}
+
+func (p removePeer) Get(group string, key string) ([]byte, error) {
+	return []byte("peer-" + key), nil
+}
+
+func (p removePeer) Remove(group string, key string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	*p.removed = append(*p.removed, p.name+":"+key)
+	return nil
+}
+
+// 以 p开头的 key属于 a，另外还有一个节点 b
+type removePicker struct {
+	a, b removePeer
+}
+
+func (r removePicker) PickPeer(key string) (PeerGetter, bool) {
+	if key != "" && key[0] == 'p' {
+		return r.a, true
+	}
+	return nil, false
+}
+
+func (r removePicker) ListPeers() []PeerGetter {
+	return []PeerGetter{r.a, r.b}
+}
+
+func newRemoveGroup(name string, opts ...GroupOption) (*Group, func() []string, *atomic.Int64) {
+	var (
+		mu      sync.Mutex
+		removed []string
+		loads   atomic.Int64
+	)
+	g := NewGroup(name, 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		loads.Add(1)
+		return []byte("local-" + key), nil
+	}), opts...)
+	g.RegisterPeers(removePicker{removePeer{"a", &mu, &removed}, removePeer{"b", &mu, &removed}})
+	return g, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		got := append([]string(nil), removed...)
+		removed = removed[:0]
+		sort.Strings(got)
+		return got
+	}, &loads
+}
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []GroupOption
+		key  string
+		want []string
+	}{
+		{"local key", nil, "k", nil},
+		{"forward to owner", nil, "pk", []string{"a:pk"}},
+		{"broadcast", []GroupOption{WithRemoveBroadcast()}, "k", []string{"a:k", "b:k"}},
+		{"broadcast with hot cache", []GroupOption{WithHotCache(1<<20, 1, 0)}, "pk", []string{"a:pk", "b:pk"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, removed, loads := newRemoveGroup("remove-"+tt.name, tt.opts...)
+			g.Get("k")
+			if err := g.Remove(tt.key); err != nil {
+				t.Fatalf("Remove: %v", err)
+			}
+			if got := removed(); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("peers removed %v, want %v", got, tt.want)
+			}
+			if tt.key == "k" {
+				g.Get("k")
+				if n := loads.Load(); n != 2 {
+					t.Fatalf("removed key not reloaded, getter called %d times", n)
+				}
+			}
+		})
+	}
+	if err := (&Group{}).Remove(""); err != ErrEmptyKey {
+		t.Fatalf("Remove(\"\") = %v, want ErrEmptyKey", err)
+	}
+}
+
+// 其他节点发来的 DELETE只删除本地缓存，不再转发
+func TestServeHTTPDelete(t *testing.T) {
+	g, removed, loads := newRemoveGroup("remove-http", WithRemoveBroadcast())
+	g.Get("k")
+	srv := httptest.NewServer(NewHTTPPool("http://peer"))
+	defer srv.Close()
+	p := NewHTTPPool("http://self")
+	p.Set(srv.URL)
+	if err := p.httpGetters[srv.URL].Remove("remove-http", "k"); err != nil {
+		t.Fatalf("httpGetter.Remove: %v", err)
+	}
+	if got := removed(); len(got) != 0 {
+		t.Fatalf("DELETE was forwarded to %v", got)
+	}
+	g.Get("k")
+	if n := loads.Load(); n != 2 {
+		t.Fatalf("DELETE did not remove the local value, getter called %d times", n)
+	}
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/_geecache/remove-http/k", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE status = %d, want 204", w.Code)
+	}
+}
@@ -0,0 +1,67 @@
+package geecache
+
+import "time"
+
+// 分片的缓存，按 key的哈希值分到 n个独立加锁的 cache里，
+// 每个分片的内存上限是总数的 1/n。
+// cache.get也要加锁（lru.Get会移动链表节点，SIEVE和 CLOCK也要加读锁），分片之后不同分片的读写不会互相阻塞
+type shardedCache struct {
+	shards []*cache
+}
+
+func newShardedCache(cacheBytes int64, n int, grace time.Duration, policy Policy) *shardedCache {
+	shardBytes := cacheBytes / int64(n)
+	if cacheBytes > 0 && shardBytes == 0 { // 0表示不限制，不能因为整除变成不限制
+		shardBytes = 1
+	}
+	s := &shardedCache{shards: make([]*cache, n)}
+	for i := range s.shards {
+		s.shards[i] = &cache{cacheBytes: shardBytes, grace: grace, policy: policy}
+	}
+	return s
+}
+
+// FNV-1a，直接对 string计算，避免转成 []byte的内存分配
+func fnv32a(key string) uint32 {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+	h := uint32(offset32)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= prime32
+	}
+	return h
+}
+
+func (s *shardedCache) shard(key string) *cache {
+	return s.shards[fnv32a(key)%uint32(len(s.shards))]
+}
+
+func (s *shardedCache) get(key string) (ByteView, bool) {
+	return s.shard(key).get(key)
+}
+
+func (s *shardedCache) add(key string, value ByteView) {
+	s.shard(key).add(key, value)
+}
+
+func (s *shardedCache) remove(key string) {
+	s.shard(key).remove(key)
+}
+
+// 所有分片的统计值之和
+func (s *shardedCache) stats() CacheStats {
+	var total CacheStats
+	for _, c := range s.shards {
+		st := c.stats()
+		total.Bytes += st.Bytes
+		total.HeapBytes += st.HeapBytes
+		total.Items += st.Items
+		total.Gets += st.Gets
+		total.Hits += st.Hits
+		total.Evictions += st.Evictions
+	}
+	return total
+}
@@ -0,0 +1,83 @@
+package geecache
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultMaxIdleConns        = 256
+	defaultMaxIdleConnsPerHost = 64 // http.DefaultTransport只有 2，节点间并发请求多的时候连接会不停地新建和关闭
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultDialTimeout         = 5 * time.Second
+	defaultTCPKeepAlive        = 30 * time.Second
+)
+
+// 请求远程节点用的 http客户端配置，零值字段使用默认值。
+// 优先级：Client > RoundTripper > 其他连接参数，Timeout总是生效
+type TransportOptions struct {
+	Client       *http.Client      // 直接使用这个客户端
+	RoundTripper http.RoundTripper // 用这个 RoundTripper创建客户端
+	Timeout      time.Duration     // 每个请求的超时时间，包括读 body，0表示不限制
+
+	MaxIdleConns        int           // 所有节点的空闲连接总数
+	MaxIdleConnsPerHost int           // 每个节点的空闲连接数
+	IdleConnTimeout     time.Duration // 空闲连接多久之后关闭
+	DialTimeout         time.Duration // 建立 TCP连接的超时时间
+	TCPKeepAlive        time.Duration // TCP keep-alive探测间隔，负数表示关闭
+	DisableKeepAlives   bool          // 每个请求都用新连接，不复用
+}
+
+// 按配置创建 http客户端。没有指定 Client和 RoundTripper时，
+// 每个 HTTPPool有自己的 Transport，不和进程里其他的 http请求共用 http.DefaultTransport
+func (o TransportOptions) client() *http.Client {
+	if o.Client != nil {
+		return o.Client
+	}
+	if o.RoundTripper != nil {
+		return &http.Client{Transport: o.RoundTripper}
+	}
+	if o.MaxIdleConns <= 0 {
+		o.MaxIdleConns = defaultMaxIdleConns
+	}
+	if o.MaxIdleConnsPerHost <= 0 {
+		o.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	if o.IdleConnTimeout <= 0 {
+		o.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	if o.DialTimeout <= 0 {
+		o.DialTimeout = defaultDialTimeout
+	}
+	if o.TCPKeepAlive == 0 {
+		o.TCPKeepAlive = defaultTCPKeepAlive
+	}
+	dialer := &net.Dialer{Timeout: o.DialTimeout, KeepAlive: o.TCPKeepAlive}
+	return &http.Client{Transport: &http.Transport{
+		DialContext:         dialer.DialContext,
+		MaxIdleConns:        o.MaxIdleConns,
+		MaxIdleConnsPerHost: o.MaxIdleConnsPerHost,
+		IdleConnTimeout:     o.IdleConnTimeout,
+		DisableKeepAlives:   o.DisableKeepAlives,
+		ForceAttemptHTTP2:   true,
+	}}
+}
+
+// 设置之后 Set创建的 httpGetter使用的 http客户端，需要在 Set之前调用。
+// 不调用时使用 TransportOptions{}的默认配置
+func (p *HTTPPool) SetTransport(opts TransportOptions) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.client = opts.client()
+	p.timeout = opts.Timeout
+}
+
+// 给请求加上超时时间，返回的 cancel在读完响应之后调用
+func (h *httpGetter) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if h.timeout > 0 {
+		return context.WithTimeout(ctx, h.timeout)
+	}
+	return context.WithCancel(ctx)
+}
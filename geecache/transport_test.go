@@ -0,0 +1,60 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTransportTimeout(t *testing.T) {
+	// 没有读 body的 handler感知不到客户端断开，测试结束时由 release放行，srv.Close才不会等它
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	p := NewHTTPPool("http://self")
+	p.SetTransport(TransportOptions{Timeout: 50 * time.Millisecond})
+	p.Set(srv.URL)
+	start := time.Now()
+	_, err := p.httpGetters[srv.URL].getView(context.Background(), "scores", "Tom")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("request took %v, timeout not applied", d)
+	}
+}
+
+type countingTransport struct {
+	n atomic.Int64
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.n.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestTransportRoundTripper(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	}))
+	defer srv.Close()
+
+	rt := &countingTransport{}
+	p := NewHTTPPool("http://self")
+	p.SetTransport(TransportOptions{RoundTripper: rt})
+	p.Set(srv.URL)
+	getter := p.httpGetters[srv.URL]
+	getter.probe(time.Second)
+	getter.Remove("scores", "Tom")
+	if n := rt.n.Load(); n != 2 {
+		t.Fatalf("custom RoundTripper used %d times, want 2", n)
+	}
+}
@@ -0,0 +1,310 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// 节点之间的二进制协议，不依赖 protobuf，手写的长度前缀格式。
+// 客户端 POST到 basePath，Content-Type为 WireContentType，body是请求消息；
+// 服务端用同样的 Content-Type返回响应消息。
+// 不带这个 Content-Type的请求还是走原来的 GET basePath/group/key，返回原始字节。
+//
+// 字符串和字节数组都编码成 uvarint长度 + 内容，整数用 varint：
+//
+//	请求: version(1B) | group | key
+//	响应: version(1B) | status(1B) | ttl(varint, 剩余的纳秒数, 0表示永不过期) | value | error
+//
+// 过期时间传的是剩余时间而不是绝对时间，节点之间的时钟不一致也没关系，
+// 只是多算了一次网络传输的时间。
+//
+// 以后增加字段时提升 version，解码时遇到不认识的 version直接报错
+const (
+	WireContentType = "application/x-geecache"
+	wireVersion     = 1
+	maxWireBody     = 64 << 20 // 请求和响应消息的最大长度
+)
+
+// 响应的状态码
+type wireStatus uint8
+
+const (
+	wireOK             wireStatus = iota // 成功，value有效
+	wireError                            // 数据源或者远程节点出错，error是错误信息
+	wireNotFound                         // 数据源里没有这个 key
+	wireNoSuchGroup                      // group不存在
+	wireBadRequest                       // 请求格式不对
+	wireConfigMismatch                   // 两个节点的配置指纹不一样
+)
+
+// 状态码和 errorHeader里的错误码一一对应
+var wireCodes = map[wireStatus]string{
+	wireError:          codeInternal,
+	wireNotFound:       codeNotFound,
+	wireNoSuchGroup:    codeNoSuchGroup,
+	wireBadRequest:     codeBadRequest,
+	wireConfigMismatch: codeConfig,
+}
+
+func wireStatusOf(code string) wireStatus {
+	for status, c := range wireCodes {
+		if c == code {
+			return status
+		}
+	}
+	return wireError
+}
+
+type wireRequest struct {
+	group string
+	key   string
+}
+
+type wireResponse struct {
+	status wireStatus
+	value  []byte
+	expire time.Time
+	err    string
+}
+
+func appendBytes(buf []byte, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+func (m *wireRequest) marshal() []byte {
+	buf := make([]byte, 0, 1+2*binary.MaxVarintLen64+len(m.group)+len(m.key))
+	buf = append(buf, wireVersion)
+	buf = appendBytes(buf, []byte(m.group))
+	buf = appendBytes(buf, []byte(m.key))
+	return buf
+}
+
+func (m *wireRequest) unmarshal(data []byte) error {
+	r := wireReader{data: data}
+	r.readVersion()
+	m.group = string(r.readBytes())
+	m.key = string(r.readBytes())
+	return r.finish()
+}
+
+func (m *wireResponse) marshal() []byte {
+	buf := make([]byte, 0, 2+3*binary.MaxVarintLen64+len(m.value)+len(m.err))
+	buf = append(buf, wireVersion, byte(m.status))
+	var ttl int64
+	if !m.expire.IsZero() {
+		ttl = int64(time.Until(m.expire))
+		if ttl <= 0 {
+			ttl = 1 // 刚好过期了，0表示永不过期，不能用
+		}
+	}
+	buf = binary.AppendVarint(buf, ttl)
+	buf = appendBytes(buf, m.value)
+	buf = appendBytes(buf, []byte(m.err))
+	return buf
+}
+
+func (m *wireResponse) unmarshal(data []byte) error {
+	r := wireReader{data: data}
+	r.readVersion()
+	m.status = wireStatus(r.readByte())
+	if ttl := r.readVarint(); ttl != 0 {
+		m.expire = time.Now().Add(time.Duration(ttl))
+	}
+	m.value = r.readBytes()
+	m.err = string(r.readBytes())
+	return r.finish()
+}
+
+var errWireTruncated = errors.New("geecache: truncated wire message")
+
+// 对方返回的不是二进制格式，也没有带 errorHeader，是不支持二进制协议的旧节点
+var errNotWire = errors.New("geecache: peer does not speak the wire format")
+
+// 按顺序读取各个字段，出错后后面的读取都直接返回零值，最后由 finish返回第一个错误
+type wireReader struct {
+	data []byte
+	err  error
+}
+
+func (r *wireReader) readByte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) < 1 {
+		r.err = errWireTruncated
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *wireReader) readVersion() {
+	if v := r.readByte(); r.err == nil && v != wireVersion {
+		r.err = fmt.Errorf("geecache: unsupported wire version %d", v)
+	}
+}
+
+func (r *wireReader) readVarint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = errWireTruncated
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *wireReader) readBytes() []byte {
+	if r.err != nil {
+		return nil
+	}
+	l, n := binary.Uvarint(r.data)
+	if n <= 0 || l > uint64(len(r.data)-n) {
+		r.err = errWireTruncated
+		return nil
+	}
+	b := r.data[n : n+int(l)]
+	r.data = r.data[n+int(l):]
+	return b
+}
+
+func (r *wireReader) finish() error {
+	if r.err == nil && len(r.data) != 0 {
+		r.err = fmt.Errorf("geecache: %d trailing bytes in wire message", len(r.data))
+	}
+	return r.err
+}
+
+// 写出二进制格式的响应
+func writeWire(w http.ResponseWriter, code int, res *wireResponse) {
+	w.Header().Set("Content-Type", WireContentType)
+	w.WriteHeader(code)
+	w.Write(res.marshal())
+}
+
+// 写出二进制格式的错误响应
+func writeWireError(w http.ResponseWriter, err error) {
+	status, code := errorStatus(err)
+	w.Header().Set(errorHeader, code)
+	writeWire(w, status, &wireResponse{status: wireStatusOf(code), err: err.Error()})
+}
+
+// 处理二进制格式的请求
+func (p *HTTPPool) serveWire(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWireBody))
+	if err != nil {
+		writeWireError(w, fmt.Errorf("%w: %v", ErrBadRequest, err))
+		return
+	}
+	var req wireRequest
+	if err := req.unmarshal(body); err != nil {
+		writeWireError(w, fmt.Errorf("%w: %v", ErrBadRequest, err))
+		return
+	}
+	p.logger.Debugf("[Server %s] wire get %s/%s", p.self, req.group, req.key)
+
+	group := GetGroup(req.group)
+	if group == nil {
+		writeWireError(w, fmt.Errorf("%w: %s", ErrNoSuchGroup, req.group))
+		return
+	}
+	group.stats.serverRequests.Add(1)
+
+	view, err := group.GetContext(r.Context(), req.key)
+	if err != nil {
+		writeWireError(w, err)
+		return
+	}
+	writeWire(w, http.StatusOK, &wireResponse{status: wireOK, value: view.b, expire: view.e})
+}
+
+// 实现 viewGetter接口，默认用二进制格式。
+// 旧节点不认识二进制请求，会返回别的格式，或者直接出错断开连接（旧版本处理 POST basePath会 panic），
+// 这时用原始字节格式再试一次，成功的话以后这个节点都用原始字节格式
+func (h *httpGetter) getView(ctx context.Context, groupName string, key string) (ByteView, error) {
+	if h.raw.Load() {
+		b, err := h.GetContext(ctx, groupName, key)
+		return ByteView{b: b}, err
+	}
+	view, err := h.getWire(ctx, groupName, key)
+	if !errors.Is(err, errNotWire) && !droppedAfterWrite(err) {
+		return view, err
+	}
+	b, rawErr := h.GetContext(ctx, groupName, key)
+	var pe *PeerError
+	if rawErr == nil || errors.As(rawErr, &pe) { // 原始字节格式能正常通信
+		if !h.raw.Swap(true) {
+			h.logger.Infof("httpGetter | %s does not speak the wire format (%v), switching to raw format", h.addr, err)
+		}
+	}
+	return ByteView{b: b}, rawErr
+}
+
+// 请求已经发出去之后连接被对方断开，旧节点不认识二进制请求时可能这样。
+// 连不上（dial出错）说明节点挂了，换格式再试一次也没用，只会让熔断器多记一次失败
+func droppedAfterWrite(err error) bool {
+	var oe *net.OpError
+	if errors.As(err, &oe) && oe.Op == "dial" {
+		return false
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// 用二进制格式从远程节点获取，返回的 ByteView带有过期时间
+func (h *httpGetter) getWire(ctx context.Context, groupName string, key string) (_ ByteView, err error) {
+	if err := h.breaker.allow(); err != nil {
+		return ByteView{}, err
+	}
+	defer func() { h.breaker.done(err) }()
+	ctx, cancel := h.requestContext(ctx)
+	defer cancel()
+	req := wireRequest{group: groupName, key: key}
+	httpReq, err := h.newRequest(ctx, http.MethodPost, h.baseURL, bytes.NewReader(req.marshal()))
+	if err != nil {
+		return ByteView{}, err
+	}
+	httpReq.Header.Set("Content-Type", WireContentType)
+	h.logger.Debugf("httpGetter | wire get %s/%s from %v", groupName, key, h.baseURL)
+	start := time.Now()
+	defer func() { h.latency.observe(time.Since(start)) }()
+	res, err := h.client.Do(httpReq)
+	if err != nil {
+		return ByteView{}, err
+	}
+	defer res.Body.Close()
+
+	if res.Header.Get("Content-Type") != WireContentType {
+		// 没有错误码的 5xx可能是代理或者对方出错了，其他的说明对方不支持二进制格式
+		if res.Header.Get(errorHeader) == "" && res.StatusCode < 500 {
+			io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<10))
+			return ByteView{}, errNotWire
+		}
+		return ByteView{}, readPeerError(res)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxWireBody))
+	if err != nil {
+		return ByteView{}, fmt.Errorf("reading response body: %v", err)
+	}
+	var msg wireResponse
+	if err := msg.unmarshal(body); err != nil {
+		return ByteView{}, err
+	}
+	if msg.status != wireOK {
+		return ByteView{}, &PeerError{Status: res.StatusCode, Code: wireCodes[msg.status], Msg: msg.err}
+	}
+	return ByteView{b: msg.value, e: msg.expire}, nil
+}
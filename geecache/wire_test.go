@@ -0,0 +1,106 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWireRoundTrip(t *testing.T) {
+	req := wireRequest{group: "scores", key: "Tom"}
+	var gotReq wireRequest
+	if err := gotReq.unmarshal(req.marshal()); err != nil || gotReq != req {
+		t.Fatalf("request round trip = %+v, %v, want %+v", gotReq, err, req)
+	}
+
+	res := wireResponse{status: wireOK, value: []byte("630"), expire: time.Now().Add(time.Minute)}
+	var gotRes wireResponse
+	if err := gotRes.unmarshal(res.marshal()); err != nil {
+		t.Fatalf("response unmarshal failed: %v", err)
+	}
+	if gotRes.status != res.status || !bytes.Equal(gotRes.value, res.value) {
+		t.Fatalf("response round trip = %+v, want %+v", gotRes, res)
+	}
+	// 传的是剩余时间，解码出来的过期时间只会晚一点点
+	if d := gotRes.expire.Sub(res.expire); d < 0 || d > time.Second {
+		t.Fatalf("expire off by %v after round trip", d)
+	}
+
+	var never wireResponse
+	if err := never.unmarshal((&wireResponse{status: wireOK}).marshal()); err != nil || !never.expire.IsZero() {
+		t.Fatalf("zero expire round trip = %v, %v", never.expire, err)
+	}
+}
+
+func TestWireMalformed(t *testing.T) {
+	data := (&wireRequest{group: "scores", key: "Tom"}).marshal()
+	var req wireRequest
+	if err := req.unmarshal(data[:len(data)-1]); err == nil {
+		t.Fatalf("truncated request should fail")
+	}
+	if err := req.unmarshal(append(data, 0)); err == nil {
+		t.Fatalf("trailing bytes should fail")
+	}
+	data[0] = wireVersion + 1
+	if err := req.unmarshal(data); err == nil {
+		t.Fatalf("unknown version should fail")
+	}
+}
+
+func TestWireFallback(t *testing.T) {
+	tests := []struct {
+		name string
+		post http.HandlerFunc // 旧节点收到二进制请求时的反应
+	}{
+		{"panic", func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) }},
+		{"plain response", func(w http.ResponseWriter, r *http.Request) { http.NotFound(w, r) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gets int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPost {
+					tt.post(w, r)
+					return
+				}
+				gets++
+				w.Write([]byte("630"))
+			}))
+			defer srv.Close()
+
+			p := NewHTTPPool("http://self")
+			p.Set(srv.URL)
+			getter := p.httpGetters[srv.URL]
+			for i := 0; i < 2; i++ {
+				view, err := getter.getView(context.Background(), "scores", "Tom")
+				if err != nil || view.String() != "630" {
+					t.Fatalf("getView = %q, %v, want 630", view.String(), err)
+				}
+			}
+			if !getter.raw.Load() || gets != 2 {
+				t.Fatalf("raw = %v, gets = %d, want raw format remembered", getter.raw.Load(), gets)
+			}
+		})
+	}
+}
+
+// 连不上的节点不用原始格式再试一次，熔断器只记一次失败
+func TestWireNoFallbackOnDialError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	addr := srv.URL
+	srv.Close()
+
+	p := NewHTTPPool("http://self")
+	p.SetBreaker(BreakerPolicy{FailThreshold: 5})
+	p.Set(addr)
+	getter := p.httpGetters[addr]
+	if _, err := getter.getView(context.Background(), "scores", "Tom"); err == nil {
+		t.Fatalf("getView from a closed port succeeded")
+	}
+	if getter.breaker.failures != 1 || getter.raw.Load() {
+		t.Fatalf("failures = %d, raw = %v, want one failure and wire format kept", getter.breaker.failures, getter.raw.Load())
+	}
+}
@@ -0,0 +1,233 @@
+package lfu
+
+import (
+	"container/list"
+	"module/lru"
+	"time"
+	"unsafe"
+)
+
+// 默认每访问 ageFactor * 节点个数 次，所有节点的访问频率减半。
+// 这样以前很热、现在已经没人访问的 key，频率会慢慢降下来被淘汰
+const ageFactor = 10
+
+// O(1)的 LFU缓存。
+// freqs是按访问频率从小到大排列的链表，每个频率节点里又有一个链表，存的是这个频率的所有 entry，
+// 同一个频率里按访问时间排列，淘汰时选频率最小的节点里最久没有被访问的 entry
+type Cache[K comparable, V any] struct {
+	maxBytes  int64 // 允许使用的最大内存
+	nbytes    int64 // 当前已经使用的内存
+	size      func(key K, value V) int64
+	items     map[K]*entry[K, V]
+	freqs     *list.List                                   // 元素是 *freqNode，按 freq从小到大
+	OnEvicted func(key K, value V, reason lru.EvictReason) // 某条记录被移除时的回调函数
+
+	ops       int   // 上一次衰减之后的访问次数
+	evictions int64 // 因为内存或者过期被淘汰的节点个数
+	now       func() time.Time
+}
+
+// 访问频率相同的 entry
+type freqNode struct {
+	freq  int
+	items *list.List // 元素是 *entry，Front是最近访问的
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	size    int64
+	expire  time.Time     // 过期时间，零值表示永不过期
+	freqEle *list.Element // 所在的频率节点
+	ele     *list.Element // 在频率节点 items里的位置
+}
+
+func (e *entry[K, V]) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+// 实例化 LFU缓存，maxBytes和 size见 lru.NewCache
+func NewCache[K comparable, V any](maxBytes int64, size func(key K, value V) int64) *Cache[K, V] {
+	if size == nil {
+		size = func(K, V) int64 { return 1 }
+	}
+	return &Cache[K, V]{
+		maxBytes: maxBytes,
+		size:     size,
+		items:    make(map[K]*entry[K, V]),
+		freqs:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// 见 lru.EntryOverhead。entry放在频率节点的链表里，频率节点本身个数不多，没有算
+func EntryOverhead[K comparable, V any]() int64 {
+	var k K
+	return lru.NodeOverhead(unsafe.Sizeof(entry[K, V]{}), unsafe.Sizeof(k))
+}
+
+// 查找 key，命中时访问频率加一。过期的节点惰性删除
+func (c *Cache[K, V]) Get(key K) (value V, ok bool) {
+	e, ok := c.items[key]
+	if !ok {
+		return
+	}
+	if e.expired(c.now()) {
+		c.removeEntry(e, lru.EvictExpired)
+		return value, false
+	}
+	c.touch(e)
+	return e.value, true
+}
+
+// key是否存在并且没有过期，不增加访问频率
+func (c *Cache[K, V]) Contains(key K) bool {
+	e, ok := c.items[key]
+	return ok && !e.expired(c.now())
+}
+
+func (c *Cache[K, V]) Add(key K, value V) {
+	c.AddWithTTL(key, value, 0)
+}
+
+// 加入或者更新 key，ttl <= 0 表示永不过期。
+// 新加入的 key频率是 1，更新已有的 key算作一次访问
+func (c *Cache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = c.now().Add(ttl)
+	}
+	size := c.size(key, value)
+	if e, ok := c.items[key]; ok {
+		c.nbytes += size - e.size
+		e.value, e.size, e.expire = value, size, expire
+		c.touch(e)
+	} else {
+		// 先腾出空间再加入，否则新节点频率最低，会马上把自己淘汰掉
+		for c.maxBytes != 0 && c.maxBytes < c.nbytes+size && len(c.items) > 0 {
+			c.RemoveLeastFrequent()
+		}
+		e := &entry[K, V]{key: key, value: value, size: size, expire: expire}
+		front := c.freqs.Front()
+		if front == nil || front.Value.(*freqNode).freq != 1 {
+			front = c.freqs.PushFront(&freqNode{freq: 1, items: list.New()})
+		}
+		e.freqEle = front
+		e.ele = front.Value.(*freqNode).items.PushFront(e)
+		c.items[key] = e
+		c.nbytes += size
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveLeastFrequent()
+	}
+}
+
+// 访问频率加一，把 entry移到下一个频率节点
+func (c *Cache[K, V]) touch(e *entry[K, V]) {
+	cur := e.freqEle
+	node := cur.Value.(*freqNode)
+	next := cur.Next()
+	if next == nil || next.Value.(*freqNode).freq != node.freq+1 {
+		next = c.freqs.InsertAfter(&freqNode{freq: node.freq + 1, items: list.New()}, cur)
+	}
+	node.items.Remove(e.ele)
+	e.freqEle = next
+	e.ele = next.Value.(*freqNode).items.PushFront(e)
+	if node.items.Len() == 0 {
+		c.freqs.Remove(cur)
+	}
+
+	c.ops++
+	if c.ops >= ageFactor*len(c.items) {
+		c.age()
+	}
+}
+
+// 所有频率减半（最小为 1），频率变得相同的节点合并。
+// 每 ageFactor * 节点个数 次访问才做一次，摊还下来还是 O(1)
+func (c *Cache[K, V]) age() {
+	c.ops = 0
+	var prev *list.Element
+	for cur := c.freqs.Front(); cur != nil; {
+		next := cur.Next()
+		node := cur.Value.(*freqNode)
+		node.freq >>= 1
+		if node.freq < 1 {
+			node.freq = 1
+		}
+		if prev != nil && prev.Value.(*freqNode).freq == node.freq {
+			// 原来频率更高的 entry放在前面，当作更近访问过的
+			dst := prev.Value.(*freqNode).items
+			for ele := node.items.Back(); ele != nil; ele = node.items.Back() {
+				e := node.items.Remove(ele).(*entry[K, V])
+				e.freqEle = prev
+				e.ele = dst.PushFront(e)
+			}
+			c.freqs.Remove(cur)
+		} else {
+			prev = cur
+		}
+		cur = next
+	}
+}
+
+// 淘汰访问频率最小的节点里，最久没有被访问的 entry
+func (c *Cache[K, V]) RemoveLeastFrequent() {
+	front := c.freqs.Front()
+	if front == nil {
+		return
+	}
+	ele := front.Value.(*freqNode).items.Back()
+	c.removeEntry(ele.Value.(*entry[K, V]), lru.EvictSize)
+}
+
+// 主动删除 key，key不存在时什么也不做
+func (c *Cache[K, V]) Remove(key K) {
+	if e, ok := c.items[key]; ok {
+		c.removeEntry(e, lru.EvictRemoved)
+	}
+}
+
+// 删除所有已经过期的节点，返回删除的个数。
+// 过期的节点不会再被访问，频率很低，一般会先被淘汰，所以 Add时不做摊还清理
+func (c *Cache[K, V]) RemoveExpired() int {
+	now := c.now()
+	n := 0
+	for _, e := range c.items {
+		if e.expired(now) {
+			c.removeEntry(e, lru.EvictExpired)
+			n++
+		}
+	}
+	return n
+}
+
+func (c *Cache[K, V]) removeEntry(e *entry[K, V], reason lru.EvictReason) {
+	node := e.freqEle.Value.(*freqNode)
+	node.items.Remove(e.ele)
+	if node.items.Len() == 0 {
+		c.freqs.Remove(e.freqEle)
+	}
+	delete(c.items, e.key)
+	c.nbytes -= e.size
+	if reason != lru.EvictRemoved {
+		c.evictions++
+	}
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value, reason)
+	}
+}
+
+func (c *Cache[K, V]) Len() int {
+	return len(c.items)
+}
+
+// 当前已经使用的内存
+func (c *Cache[K, V]) Bytes() int64 {
+	return c.nbytes
+}
+
+// 被淘汰的节点总数
+func (c *Cache[K, V]) Evictions() int64 {
+	return c.evictions
+}
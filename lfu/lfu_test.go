@@ -0,0 +1,82 @@
+package lfu
+
+import (
+	"module/lru"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGet(t *testing.T) {
+	lfu := NewCache[string, string](0, nil)
+	lfu.Add("k1", "1234")
+	if v, ok := lfu.Get("k1"); !ok || v != "1234" {
+		t.Fatalf("cache hit k1=1234 failed")
+	}
+	if _, ok := lfu.Get("k2"); ok {
+		t.Fatalf("cache miss k2 failed")
+	}
+}
+
+func TestRemoveLeastFrequent(t *testing.T) {
+	lfu := NewCache[string, int](3, nil)
+	lfu.Add("hot", 1)
+	lfu.Add("warm", 2)
+	lfu.Add("cold", 3)
+	lfu.Get("hot")
+	lfu.Get("hot")
+	lfu.Get("warm")
+	lfu.Add("new", 4) // cold的频率最小，被淘汰
+	if lfu.Contains("cold") || !lfu.Contains("hot") || !lfu.Contains("warm") || !lfu.Contains("new") {
+		t.Fatalf("least frequently used key cold should be evicted")
+	}
+	lfu.Add("newer", 5) // new和 newer频率都是 1，淘汰更早加入的 new
+	if lfu.Contains("new") || !lfu.Contains("newer") {
+		t.Fatalf("least recently used key among the same frequency should be evicted")
+	}
+}
+
+func TestAging(t *testing.T) {
+	lfu := NewCache[string, int](0, nil)
+	lfu.Add("k1", 1)
+	lfu.Add("k2", 2)
+	for i := 0; i < 5; i++ {
+		lfu.Get("k1")
+	}
+	lfu.age()
+	freq := lfu.items["k1"].freqEle.Value.(*freqNode).freq
+	if freq != 3 {
+		t.Fatalf("k1 freq after aging = %d, want 3", freq)
+	}
+	freq = lfu.items["k2"].freqEle.Value.(*freqNode).freq
+	if freq != 1 {
+		t.Fatalf("k2 freq after aging = %d, want 1", freq)
+	}
+}
+
+func TestOnEvicted(t *testing.T) {
+	var reasons []lru.EvictReason
+	now := time.Now()
+	lfu := NewCache[string, string](2, nil)
+	lfu.now = func() time.Time { return now }
+	lfu.OnEvicted = func(key string, value string, reason lru.EvictReason) {
+		reasons = append(reasons, reason)
+	}
+	lfu.AddWithTTL("k1", "v1", time.Second)
+	lfu.Add("k2", "v2")
+	lfu.Add("k3", "v3")
+	now = now.Add(time.Minute)
+	lfu.Add("k4", "v4")
+	lfu.Remove("k4")
+	lfu.AddWithTTL("k5", "v5", time.Second)
+	now = now.Add(time.Minute)
+	lfu.Get("k5")
+
+	expect := []lru.EvictReason{lru.EvictSize, lru.EvictSize, lru.EvictRemoved, lru.EvictExpired}
+	if !reflect.DeepEqual(expect, reasons) {
+		t.Fatalf("OnEvicted reasons = %v, want %v", reasons, expect)
+	}
+	if lfu.Evictions() != 3 {
+		t.Fatalf("Evictions = %d, want 3", lfu.Evictions())
+	}
+}
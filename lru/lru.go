@@ -2,22 +2,59 @@ package lru
 
 import (
 	"container/list"
+	"time"
 )
 
+// 每次 Add时顺带检查的节点个数，摊还地回收过期节点。sieve和 clock也用它
+const SweepBatch = 4
+
+// 节点被移除的原因
+type EvictReason int
+
+const (
+	EvictSize    EvictReason = iota // 超过 maxBytes，淘汰最近最少访问的节点
+	EvictExpired                    // 节点过期
+	EvictRemoved                    // 调用方主动删除
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictSize:
+		return "size"
+	case EvictExpired:
+		return "expired"
+	case EvictRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
 // 包含字典和双向链表
-type Cache struct {
+// K是 key的类型，V是 value的类型，每个节点占用的内存由 size函数计算
+type Cache[K comparable, V any] struct {
 	maxBytes int64 // 允许使用的最大内存
-	nbytes   int64 // 当前已经使用的内存，这个内存大小是包含ll节点的key的大小和节点的value的大小的
-	cache    map[string]*list.Element
+	nbytes   int64 // 当前已经使用的内存，是所有节点 size(key, value)的和
+	size     func(key K, value V) int64
+	cache    map[K]*list.Element
 	// value是链表中某个节点的指针. 另外，list的Element的Value字段是any类型，实际是interface{}空接口类型
-	ll        *list.List                    // 双向链表存的才是真正的值，每个节点entry的value存值，entry的key就是map的key
-	OnEvicted func(key string, value Value) // 某条记录被移除时的回调函数
+	ll        *list.List                               // 双向链表存的才是真正的值，每个节点entry的value存值，entry的key就是map的key
+	OnEvicted func(key K, value V, reason EvictReason) // 某条记录被移除时的回调函数，reason说明是因为内存还是因为过期被移除
+
+	evictions int64            // 因为内存或者过期被淘汰的节点个数，不包括主动删除的
+	cursor    *list.Element    // 摊还清理过期节点时，上一次检查停下的位置
+	now       func() time.Time // 当前时间，测试时可以替换
 }
 
 // 双向链表的节点
-type entry struct {
-	key   string
-	value Value // value可以是任意类型，只要他实现了 Value接口（ 这里就是为了通用性）
+type entry[K comparable, V any] struct {
+	key    K
+	value  V
+	size   int64     // 加入时计算的 size(key, value)
+	expire time.Time // 过期时间，零值表示永不过期
+}
+
+func (e *entry[K, V]) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
 }
 
 // 计算value占用了多少内存
@@ -26,39 +63,179 @@ type Value interface {
 }
 
 // 实例化Cache， 允许的最大内存和删除时的回调是自己传入。
-func New(maxBytes int64, onEvicted func(key string, value Value)) *Cache {
-	return &Cache{
-		maxBytes:  maxBytes,
-		nbytes:    0,
-		cache:     make(map[string]*list.Element),
-		ll:        list.New(),
-		OnEvicted: onEvicted,
+// 这是原来的 string key + Value接口的用法，节点大小是 len(key) + value.Len()
+func New(maxBytes int64, onEvicted func(key string, value Value, reason EvictReason)) *Cache[string, Value] {
+	c := NewCache[string, Value](maxBytes, func(key string, value Value) int64 {
+		return int64(len(key)) + int64(value.Len())
+	})
+	c.OnEvicted = onEvicted
+	return c
+}
+
+// 实例化泛型的 Cache，size计算每个节点占用的内存，
+// size为 nil时每个节点算作 1，这时 maxBytes就是最多的节点个数。
+// lfu、arc、sieve、clock、tinylfu的 maxBytes和 size都是这个意思
+func NewCache[K comparable, V any](maxBytes int64, size func(key K, value V) int64) *Cache[K, V] {
+	if size == nil {
+		size = func(K, V) int64 { return 1 }
+	}
+	return &Cache[K, V]{
+		maxBytes: maxBytes,
+		nbytes:   0,
+		size:     size,
+		cache:    make(map[K]*list.Element),
+		ll:       list.New(),
+		now:      time.Now,
 	}
 }
 
 // 查找功能： 从map中找到链表里的目标节点，将该节点移动到队尾(高频次访问)
-func (c *Cache) Get(key string) (value Value, ok bool) {
+// 节点已经过期的话，惰性删除，当作未命中
+func (c *Cache[K, V]) Get(key K) (value V, ok bool) {
 	if ele, ok := c.cache[key]; ok { // ele是*list.Element类型，是某个节点的指针
-		c.ll.MoveToFront(ele) // 双向链表的头和尾是相对的，这里作者定义Front为尾了，为了后面的统一，这里不按自己的理解改了
 		// ele.Value 是interface{} 类型，如果不进行下面的类型断言，是不能访问到 *entry的value的
-		kv := ele.Value.(*entry) // ele就是map的value:list.Element。 *entry是类型断言，告诉编译器 ele.Value 实际上应该被视为 *entry 类型
-		return kv.value, true    // 这里不能转成 entry，必须是 *entry, 因为ll就是*list.Element，指针类型
+		kv := ele.Value.(*entry[K, V]) // ele就是map的value:list.Element。 *entry是类型断言，告诉编译器 ele.Value 实际上应该被视为 *entry 类型
+		if kv.expired(c.now()) {
+			c.removeElement(ele, EvictExpired)
+			return value, false
+		}
+		c.ll.MoveToFront(ele) // 双向链表的头和尾是相对的，这里作者定义Front为尾了，为了后面的统一，这里不按自己的理解改了
+		return kv.value, true // 这里不能转成 entry，必须是 *entry, 因为ll就是*list.Element，指针类型
+	}
+	return
+}
+
+// 和 Get一样，但是不移动节点，不影响淘汰顺序，也不删除过期节点
+func (c *Cache[K, V]) Peek(key K) (value V, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry[K, V])
+		if !kv.expired(c.now()) {
+			return kv.value, true
+		}
 	}
 	return
 }
 
+// key是否存在并且没有过期，不移动节点
+func (c *Cache[K, V]) Contains(key K) bool {
+	_, ok := c.Peek(key)
+	return ok
+}
+
+// 按访问顺序返回所有没有过期的 key，最近访问的在前面
+func (c *Cache[K, V]) Keys() []K {
+	now := c.now()
+	keys := make([]K, 0, c.ll.Len())
+	for ele := c.ll.Front(); ele != nil; ele = ele.Next() {
+		if kv := ele.Value.(*entry[K, V]); !kv.expired(now) {
+			keys = append(keys, kv.key)
+		}
+	}
+	return keys
+}
+
+// 返回下一个会被淘汰的节点，也就是最久没有被访问的节点，不移动节点
+func (c *Cache[K, V]) Oldest() (key K, value V, ok bool) {
+	if ele := c.ll.Back(); ele != nil {
+		kv := ele.Value.(*entry[K, V])
+		return kv.key, kv.value, true
+	}
+	return
+}
+
+// 按淘汰顺序返回接下来会被淘汰的 key，它们的 size加起来至少是 need，
+// 节点不够时返回所有 key。不移动节点
+func (c *Cache[K, V]) Victims(need int64) []K {
+	var keys []K
+	for ele := c.ll.Back(); ele != nil && need > 0; ele = ele.Prev() {
+		kv := ele.Value.(*entry[K, V])
+		keys = append(keys, kv.key)
+		need -= kv.size
+	}
+	return keys
+}
+
 // 删除最近最少被访问的节点，也就是队首的节点。
 // 同时要删除map里面的key，并更新Cache结构目前的内存大小
-func (c *Cache) RemoveOldest() {
+func (c *Cache[K, V]) RemoveOldest() {
 	ele := c.ll.Back() // Back()返回的是 last element(对应作者定义的“头”),  Front()返回的是 first element
 	if ele != nil {
-		c.ll.Remove(ele)
-		kv := ele.Value.(*entry)
-		delete(c.cache, kv.key) // 还要删除 map里面的 key
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
+		c.removeElement(ele, EvictSize)
+	}
+}
+
+// 主动删除 key对应的节点，key不存在时什么也不做
+func (c *Cache[K, V]) Remove(key K) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele, EvictRemoved)
+	}
+}
+
+// 删除所有节点，每个节点都会以 EvictRemoved调用 OnEvicted
+func (c *Cache[K, V]) Purge() {
+	for ele := c.ll.Back(); ele != nil; ele = c.ll.Back() {
+		c.removeElement(ele, EvictRemoved)
+	}
+}
+
+// 修改允许使用的最大内存，变小时立即淘汰多出来的节点，返回淘汰的个数
+func (c *Cache[K, V]) Resize(maxBytes int64) int {
+	c.maxBytes = maxBytes
+	n := 0
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+		n++
+	}
+	return n
+}
+
+// 删除所有已经过期的节点，返回删除的个数。
+// 需要及时回收内存时，可以由调用方在后台定期调用
+func (c *Cache[K, V]) RemoveExpired() int {
+	now := c.now()
+	n := 0
+	for ele := c.ll.Back(); ele != nil; {
+		prev := ele.Prev()
+		if ele.Value.(*entry[K, V]).expired(now) {
+			c.removeElement(ele, EvictExpired)
+			n++
 		}
+		ele = prev
+	}
+	return n
+}
+
+// 从上次停下的位置开始，最多检查 n个节点，删除其中已经过期的。
+// 游标所在的节点被移除后 Prev()会返回 nil，这时从队首重新开始
+func (c *Cache[K, V]) sweep(n int) {
+	now := c.now()
+	for i := 0; i < n; i++ {
+		ele := c.cursor
+		if ele == nil {
+			if ele = c.ll.Back(); ele == nil {
+				return
+			}
+		}
+		c.cursor = ele.Prev()
+		if ele.Value.(*entry[K, V]).expired(now) {
+			c.removeElement(ele, EvictExpired)
+		}
+	}
+}
+
+func (c *Cache[K, V]) removeElement(ele *list.Element, reason EvictReason) {
+	if ele == c.cursor {
+		c.cursor = ele.Prev()
+	}
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry[K, V])
+	delete(c.cache, kv.key) // 还要删除 map里面的 key
+	c.nbytes -= kv.size
+	if reason != EvictRemoved {
+		c.evictions++
+	}
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value, reason)
 	}
 }
 
@@ -67,23 +244,46 @@ func (c *Cache) RemoveOldest() {
 // 判断一下新内存是否超过了maxBytes，超过了就要做删低频访问节点的操作
 // 这里有一个小疑惑？？传入的 key应该是什么？我们的缓存系统应该是只care链表里面存的值，这才是目标存储值，
 // 或者key就设计者随意定义赋值了，只要他能和目标存储的entry能建立映射就 ok了？
-func (c *Cache) Add(key string, value Value) {
+func (c *Cache[K, V]) Add(key K, value V) {
+	c.AddWithTTL(key, value, 0)
+}
+
+// 和 Add一样，但是节点在 ttl之后过期，ttl <= 0 表示永不过期
+func (c *Cache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = c.now().Add(ttl)
+	}
+	size := c.size(key, value)
 	if ele, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(ele)
-		kv := ele.Value.(*entry)
-		c.nbytes += int64(value.Len()) - int64(kv.value.Len()) // 更新占用内存大小
+		kv := ele.Value.(*entry[K, V])
+		c.nbytes += size - kv.size // 更新占用内存大小
 		kv.value = value
+		kv.size = size
+		kv.expire = expire
 	} else {
-		ele := c.ll.PushFront(&entry{key, value})
+		ele := c.ll.PushFront(&entry[K, V]{key, value, size, expire})
 		c.cache[key] = ele
-		c.nbytes += int64(len(key)) + int64(value.Len())
+		c.nbytes += size
 	}
+	c.sweep(SweepBatch)
 	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
 		c.RemoveOldest()
 	}
 
 }
 
-func (c *Cache) Len() int {
+func (c *Cache[K, V]) Len() int {
 	return c.ll.Len()
 }
+
+// 当前已经使用的内存
+func (c *Cache[K, V]) Bytes() int64 {
+	return c.nbytes
+}
+
+// 被淘汰的节点总数
+func (c *Cache[K, V]) Evictions() int64 {
+	return c.evictions
+}
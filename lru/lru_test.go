@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type String string
@@ -39,7 +40,7 @@ func TestRemoveoldest(t *testing.T) {
 
 func TestOnEvicted(t *testing.T) {
 	keys := make([]string, 0)
-	callback := func(key string, value Value) {
+	callback := func(key string, value Value, reason EvictReason) {
 		keys = append(keys, key)
 	}
 	lru := New(int64(10), callback)
@@ -57,4 +58,159 @@ func TestOnEvicted(t *testing.T) {
 	if !reflect.DeepEqual(expect, keys) {
 		t.Fatalf("Call OnEvicted failed, expect keys equals to %s", expect)
 	}
+	if lru.Evictions() != 2 {
+		t.Fatalf("Evictions = %d, want 2", lru.Evictions())
+	}
+}
+
+func TestTTL(t *testing.T) {
+	now := time.Now()
+	lru := New(int64(0), nil)
+	lru.now = func() time.Time { return now }
+	lru.AddWithTTL("k1", String("1234"), time.Second)
+	lru.Add("k2", String("5678"))
+	if _, ok := lru.Get("k1"); !ok {
+		t.Fatalf("cache hit k1 before expire failed")
+	}
+	now = now.Add(time.Second)
+	if _, ok := lru.Get("k1"); ok || lru.Len() != 1 {
+		t.Fatalf("expired k1 should be removed on Get")
+	}
+	if _, ok := lru.Get("k2"); !ok {
+		t.Fatalf("k2 without ttl should never expire")
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	now := time.Now()
+	reasons := make(map[string]EvictReason)
+	lru := New(int64(0), func(key string, value Value, reason EvictReason) {
+		reasons[key] = reason
+	})
+	lru.now = func() time.Time { return now }
+	lru.AddWithTTL("k1", String("v1"), time.Second)
+	lru.AddWithTTL("k2", String("v2"), time.Minute)
+	lru.AddWithTTL("k3", String("v3"), time.Second)
+	now = now.Add(2 * time.Second)
+	if n := lru.RemoveExpired(); n != 2 || lru.Len() != 1 {
+		t.Fatalf("RemoveExpired removed %d, want 2", n)
+	}
+	expect := map[string]EvictReason{"k1": EvictExpired, "k3": EvictExpired}
+	if !reflect.DeepEqual(expect, reasons) {
+		t.Fatalf("OnEvicted reasons = %v, want %v", reasons, expect)
+	}
+}
+
+func TestSweepOnAdd(t *testing.T) {
+	now := time.Now()
+	lru := New(int64(0), nil)
+	lru.now = func() time.Time { return now }
+	for i := 0; i < SweepBatch; i++ {
+		lru.AddWithTTL(fmt.Sprintf("k%d", i), String("v"), time.Second)
+	}
+	now = now.Add(2 * time.Second)
+	lru.Add("fresh1", String("v"))
+	lru.Add("fresh2", String("v"))
+	if lru.Len() != 2 {
+		t.Fatalf("expired keys should be swept on Add, got len %d", lru.Len())
+	}
+}
+
+func TestRemove(t *testing.T) {
+	var reason EvictReason = -1
+	lru := New(int64(0), func(key string, value Value, r EvictReason) {
+		reason = r
+	})
+	lru.Add("k1", String("1234"))
+	lru.Remove("k1")
+	if _, ok := lru.Get("k1"); ok || lru.Len() != 0 || lru.nbytes != 0 {
+		t.Fatalf("Remove k1 failed")
+	}
+	if reason != EvictRemoved {
+		t.Fatalf("OnEvicted reason = %v, want %v", reason, EvictRemoved)
+	}
+	lru.Remove("k2") // 不存在的 key
+}
+
+func TestGeneric(t *testing.T) {
+	lru := NewCache[int, string](2, nil) // 每个节点算作 1，最多 2个节点
+	lru.Add(1, "one")
+	lru.Add(2, "two")
+	if v, ok := lru.Get(1); !ok || v != "one" {
+		t.Fatalf("cache hit 1=one failed")
+	}
+	lru.Add(3, "three")
+	if lru.Contains(2) || !lru.Contains(1) || !lru.Contains(3) {
+		t.Fatalf("least recently used key 2 should be evicted")
+	}
+}
+
+func TestPeek(t *testing.T) {
+	lru := NewCache[string, string](2, nil)
+	lru.Add("k1", "v1")
+	lru.Add("k2", "v2")
+	if v, ok := lru.Peek("k1"); !ok || v != "v1" {
+		t.Fatalf("peek k1 failed")
+	}
+	lru.Add("k3", "v3") // Peek不会更新 k1的访问顺序，k1被淘汰
+	if lru.Contains("k1") {
+		t.Fatalf("Peek should not bump recency of k1")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	lru := NewCache[string, int](0, nil)
+	lru.Add("k1", 1)
+	lru.Add("k2", 2)
+	lru.Add("k3", 3)
+	lru.Get("k1")
+	expect := []string{"k1", "k3", "k2"}
+	if keys := lru.Keys(); !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Keys = %v, want %v", keys, expect)
+	}
+	if key, v, ok := lru.Oldest(); !ok || key != "k2" || v != 2 {
+		t.Fatalf("Oldest = %v %v, want k2 2", key, v)
+	}
+	if victims := lru.Victims(2); !reflect.DeepEqual(victims, []string{"k2", "k3"}) {
+		t.Fatalf("Victims(2) = %v, want [k2 k3]", victims)
+	}
+	if victims := lru.Victims(10); len(victims) != 3 {
+		t.Fatalf("Victims(10) = %v, want all keys", victims)
+	}
+}
+
+func TestResizeAndPurge(t *testing.T) {
+	evicted := 0
+	lru := New(int64(0), func(key string, value Value, reason EvictReason) {
+		evicted++
+	})
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Add("k3", String("v3"))
+	if n := lru.Resize(int64(len("k3v3"))); n != 2 || lru.Len() != 1 || !lru.Contains("k3") {
+		t.Fatalf("Resize evicted %d, want 2", n)
+	}
+	lru.Purge()
+	if lru.Len() != 0 || lru.Bytes() != 0 || evicted != 3 {
+		t.Fatalf("Purge failed, len %d, bytes %d, evicted %d", lru.Len(), lru.Bytes(), evicted)
+	}
+}
+
+func TestEntryOverhead(t *testing.T) {
+	for _, tt := range []struct {
+		n    uintptr
+		want int64
+	}{{0, 0}, {1, 8}, {40, 48}, {96, 96}, {97, 112}, {32769, 40960}} {
+		if got := allocSize(tt.n); got != tt.want {
+			t.Errorf("allocSize(%d) = %d, want %d", tt.n, got, tt.want)
+		}
+	}
+	// entry 96、list.Element 48、map槽位 (16+8+1)*3/2
+	if got := EntryOverhead[string, [6]uintptr](); got != 96+48+37 {
+		t.Fatalf("EntryOverhead = %d, want %d", got, 96+48+37)
+	}
+	// int key的 entry 88字节，也按 96分配，但 map槽位小一些
+	if small, big := EntryOverhead[int, [6]uintptr](), EntryOverhead[string, [6]uintptr](); small >= big {
+		t.Fatalf("EntryOverhead[int] = %d should be smaller than EntryOverhead[string] = %d", small, big)
+	}
 }
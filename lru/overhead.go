@@ -0,0 +1,49 @@
+package lru
+
+import (
+	"container/list"
+	"unsafe"
+)
+
+// Go内存分配的规格（runtime/sizeclasses.go），小对象按不小于它的规格分配
+var sizeClasses = [...]uintptr{
+	8, 16, 24, 32, 48, 64, 80, 96, 112, 128, 144, 160, 176, 192, 208, 224, 240, 256,
+	288, 320, 352, 384, 416, 448, 480, 512, 576, 640, 704, 768, 896, 1024, 1152, 1280,
+	1408, 1536, 1792, 2048, 2304, 2688, 3072, 3200, 3456, 4096, 4864, 5376, 6144, 6528,
+	6784, 6912, 8192, 9472, 9728, 10240, 10880, 12288, 13568, 14336, 16384, 18432, 19072,
+	20480, 21760, 24576, 27264, 28672, 32768,
+}
+
+// 分配 n字节实际占用的堆内存，大对象按 8K的页向上取整
+func allocSize(n uintptr) int64 {
+	if n == 0 {
+		return 0
+	}
+	for _, c := range sizeClasses {
+		if n <= c {
+			return int64(c)
+		}
+	}
+	const page = 8192
+	return int64((n + page - 1) / page * page)
+}
+
+// 一个节点除了 key和值本身，在堆上额外占用的内存（64位系统）：
+//
+//	entry        entrySize按分配规格向上取整
+//	list.Element 48字节（next、prev、list三个指针加 Value接口，40字节向上取整）
+//	map的槽位    key加一个指针再加一个控制字节，map扩容之后平均只用了三分之二左右
+//
+// lfu、arc、sieve、clock的节点结构不一样，用各自的 entry大小调用
+func NodeOverhead(entrySize, keySize uintptr) int64 {
+	const ptrSize = unsafe.Sizeof(uintptr(0))
+	return allocSize(entrySize) + allocSize(unsafe.Sizeof(list.Element{})) + int64(keySize+ptrSize+1)*3/2
+}
+
+// lru.Cache每个节点在堆上额外占用的内存。
+// size加上它，maxBytes限制的就是估计的堆内存，值很小的时候这部分比值本身大得多。
+// 其他淘汰算法的包也有 EntryOverhead，用法一样，只是按各自的节点结构计算
+func EntryOverhead[K comparable, V any]() int64 {
+	var k K
+	return NodeOverhead(unsafe.Sizeof(entry[K, V]{}), unsafe.Sizeof(k))
+}
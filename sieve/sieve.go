@@ -0,0 +1,210 @@
+package sieve
+
+import (
+	"container/list"
+	"module/lru"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// SIEVE缓存。
+// 所有节点按加入的顺序排成一个队列，新节点放在队头，命中时只把 visited设为 true，不移动节点。
+// 淘汰时指针 hand从队尾往队头走，visited的节点清除标记后跳过，遇到没有 visited的就淘汰，
+// hand停在那里，下次接着往前走，走到队头再回到队尾。
+// 因为 Get不修改 map和链表，只原子地设置 visited，多个 Get可以在读锁下并发调用，
+// 但 Get和 Add、Remove之间还是要调用方加锁
+type Cache[K comparable, V any] struct {
+	maxBytes  int64 // 允许使用的最大内存
+	nbytes    int64 // 当前已经使用的内存
+	size      func(key K, value V) int64
+	items     map[K]*list.Element
+	ll        *list.List    // Front是最新加入的
+	hand      *list.Element // 下一次淘汰从这里开始检查，nil表示从队尾开始
+	cursor    *list.Element // 摊还清理过期节点时，上一次检查停下的位置
+	OnEvicted func(key K, value V, reason lru.EvictReason)
+
+	evictions int64 // 因为内存或者过期被淘汰的节点个数
+	now       func() time.Time
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	size    int64
+	expire  time.Time // 过期时间，零值表示永不过期
+	visited atomic.Bool
+}
+
+func (e *entry[K, V]) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+// 实例化 SIEVE缓存，maxBytes和 size见 lru.NewCache
+func NewCache[K comparable, V any](maxBytes int64, size func(key K, value V) int64) *Cache[K, V] {
+	if size == nil {
+		size = func(K, V) int64 { return 1 }
+	}
+	return &Cache[K, V]{
+		maxBytes: maxBytes,
+		size:     size,
+		items:    make(map[K]*list.Element),
+		ll:       list.New(),
+		now:      time.Now,
+	}
+}
+
+// 见 lru.EntryOverhead，entry多了 visited标记
+func EntryOverhead[K comparable, V any]() int64 {
+	var k K
+	return lru.NodeOverhead(unsafe.Sizeof(entry[K, V]{}), unsafe.Sizeof(k))
+}
+
+// 查找 key，命中时设置 visited。过期的节点当作不存在，等淘汰时再删除
+func (c *Cache[K, V]) Get(key K) (value V, ok bool) {
+	ele, ok := c.items[key]
+	if !ok {
+		return
+	}
+	e := ele.Value.(*entry[K, V])
+	if e.expired(c.now()) {
+		return value, false
+	}
+	e.visited.Store(true)
+	return e.value, true
+}
+
+// key是否存在并且没有过期，不设置 visited
+func (c *Cache[K, V]) Contains(key K) bool {
+	ele, ok := c.items[key]
+	return ok && !ele.Value.(*entry[K, V]).expired(c.now())
+}
+
+func (c *Cache[K, V]) Add(key K, value V) {
+	c.AddWithTTL(key, value, 0)
+}
+
+// 加入或者更新 key，ttl <= 0 表示永不过期。更新已有的 key算作一次访问
+func (c *Cache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = c.now().Add(ttl)
+	}
+	c.sweep(lru.SweepBatch)
+	size := c.size(key, value)
+	if ele, ok := c.items[key]; ok {
+		e := ele.Value.(*entry[K, V])
+		c.nbytes += size - e.size
+		e.value, e.size, e.expire = value, size, expire
+		e.visited.Store(true)
+	} else {
+		// 先腾出空间再加入，否则新节点没有 visited，hand转一圈之后会把它自己淘汰掉
+		for c.maxBytes != 0 && c.maxBytes < c.nbytes+size && c.ll.Len() > 0 {
+			c.evict()
+		}
+		c.items[key] = c.ll.PushFront(&entry[K, V]{key: key, value: value, size: size, expire: expire})
+		c.nbytes += size
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.evict()
+	}
+}
+
+// 移动 hand，淘汰一个没有 visited或者已经过期的节点
+func (c *Cache[K, V]) evict() {
+	now := c.now()
+	ele := c.hand
+	if ele == nil {
+		ele = c.ll.Back()
+	}
+	reason := lru.EvictSize
+	for {
+		e := ele.Value.(*entry[K, V])
+		if e.expired(now) {
+			reason = lru.EvictExpired
+			break
+		}
+		if !e.visited.Load() {
+			break
+		}
+		e.visited.Store(false)
+		if ele = ele.Prev(); ele == nil {
+			ele = c.ll.Back()
+		}
+	}
+	c.hand = ele // removeElement会把 hand移到下一个位置
+	c.removeElement(ele, reason)
+}
+
+// 主动删除 key，key不存在时什么也不做
+func (c *Cache[K, V]) Remove(key K) {
+	if ele, ok := c.items[key]; ok {
+		c.removeElement(ele, lru.EvictRemoved)
+	}
+}
+
+// 删除所有已经过期的节点，返回删除的个数
+func (c *Cache[K, V]) RemoveExpired() int {
+	now := c.now()
+	n := 0
+	for ele := c.ll.Back(); ele != nil; {
+		prev := ele.Prev()
+		if ele.Value.(*entry[K, V]).expired(now) {
+			c.removeElement(ele, lru.EvictExpired)
+			n++
+		}
+		ele = prev
+	}
+	return n
+}
+
+// 从上次停下的位置往队首最多检查 n个节点，删除过期的，和 lru.Cache的 sweep一样。
+// Get在读锁下不能删除过期节点，没有 maxBytes限制时，不再被访问的过期节点只能靠这里回收
+func (c *Cache[K, V]) sweep(n int) {
+	now := c.now()
+	for i := 0; i < n; i++ {
+		ele := c.cursor
+		if ele == nil {
+			if ele = c.ll.Back(); ele == nil {
+				return
+			}
+		}
+		c.cursor = ele.Prev()
+		if ele.Value.(*entry[K, V]).expired(now) {
+			c.removeElement(ele, lru.EvictExpired)
+		}
+	}
+}
+
+func (c *Cache[K, V]) removeElement(ele *list.Element, reason lru.EvictReason) {
+	if c.hand == ele {
+		c.hand = ele.Prev()
+	}
+	if c.cursor == ele {
+		c.cursor = ele.Prev()
+	}
+	c.ll.Remove(ele)
+	e := ele.Value.(*entry[K, V])
+	delete(c.items, e.key)
+	c.nbytes -= e.size
+	if reason != lru.EvictRemoved {
+		c.evictions++
+	}
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value, reason)
+	}
+}
+
+func (c *Cache[K, V]) Len() int {
+	return c.ll.Len()
+}
+
+// 当前已经使用的内存
+func (c *Cache[K, V]) Bytes() int64 {
+	return c.nbytes
+}
+
+// 被淘汰的节点总数
+func (c *Cache[K, V]) Evictions() int64 {
+	return c.evictions
+}
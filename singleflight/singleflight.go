@@ -1,6 +1,8 @@
 package singleflight
 
 import (
+	"context"
+	"errors"
 	"sync"
 )
 
@@ -8,7 +10,10 @@ type call struct { // 正在进行中或者已经结束的请求
 	wg  sync.WaitGroup
 	val interface{}
 	err error
-	dup bool
+
+	done    chan struct{}      // fn返回后关闭，DoContext的等待者可以和自己的 ctx.Done()一起 select
+	waiters int                // 还在等待结果的调用方个数
+	cancel  context.CancelFunc // 所有等待者都放弃时，取消 fn的 ctx，只有 DoContext创建的 call才有
 }
 
 type Group struct {
@@ -19,7 +24,8 @@ type Group struct {
 // group.load()被并发调用，g.loader.Do()被并发调用，有一个线程第一个拿到锁，第一次new(call)
 // wg.Add(1)，调用fn()后 wg.Done()，最后又删除了 map[key]（删除key的原因：占用内存了；缓存key都放在lru里面，如果这里不删除key，那么key-value还要保持更新。）
 // 其他线程在第一个线程调用fn()之前，都只能 wg.Wait()等等（因为被 wg.Add(1)阻塞）
-// 那如果有线程是在删除了 map[key]之后去拿到锁，g.m[key]依然不存在这样又要 new一遍 call了？
+// 在删除了 map[key]之后才拿到锁的线程，会重新 new一个 call再调用一次fn()，
+// 这时候值一般已经在 lru里了，group.Get()不会走到这里
 
 // 针对相同的 key，无论 Do 被调用多少次，函数 fn 都只会被调用一次，
 // 等待 fn 调用结束了，返回返回值或错误
@@ -29,34 +35,187 @@ func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, err
 		g.m = make(map[string]*call)
 	}
 	if c, ok := g.m[key]; ok {
-		c.dup = true
+		c.waiters++ // Do不会中途放弃，加入之后 DoContext创建的 call就不会被取消了
 		g.mu.Unlock()
 		c.wg.Wait()
 		return c.val, c.err
 	}
-	c := new(call)
+	c := &call{done: make(chan struct{})} // DoContext也可能加入这个 call，需要 done
 	c.wg.Add(1)
+	c.waiters = 1 // 创建者自己也在等待，并且不会放弃
 	g.m[key] = c
 	g.mu.Unlock()
 
 	c.val, c.err = fn()
 	c.wg.Done()
+	close(c.done)
 
-	// g.mu.Lock()
-	// delete(g.m, key)
-	// g.mu.Unlock()
-	// 1. 下面是另一种写法，上面的写法实际无法做到使fn()只被调用一次
-	// 通过singleflight_test看，这是有效的。
-	// go func() {
-	// 	time.Sleep(time.Second)
-	// 	delete(g.m, key)
-	// }()
-	// 2. 这种做法也可以。
+	// 调用结束后一定要删除 key，否则之后对同一个 key的 Do都会直接返回这次的结果，
+	// 过期或者被 Remove的 key就再也不会重新加载了。
+	// 在 fn()执行期间到达的请求已经拿到了 c，会等待并共享这次的结果
 	g.mu.Lock()
-	if c.dup {
-		delete(g.m, key) // 仅仅再确认没有重复请求时删除
-	}
+	delete(g.m, key)
 	g.mu.Unlock()
 
 	return c.val, c.err
 }
+
+// 和 Do一样合并相同 key的调用，但是 fn在单独的 goroutine里执行，
+// 每个调用方都可以因为自己的 ctx被取消而提前返回 ctx.Err()，不影响其他还在等待的调用方。
+// 只有所有调用方都放弃了，传给 fn的 ctx才会被取消。
+// 注意传给 fn的 ctx不带调用方 ctx里的值。
+// shared表示这次调用是否加入了一个已经在进行中的调用
+func (g *Group) DoContext(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (v interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	c, shared := g.m[key]
+	if !shared {
+		fnCtx, cancel := context.WithCancel(context.Background())
+		c = &call{done: make(chan struct{}), cancel: cancel}
+		c.wg.Add(1)
+		g.m[key] = c
+		go g.run(fnCtx, c, key, fn)
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, c.err, shared
+	case <-ctx.Done():
+		g.abandon(key, c)
+		return nil, ctx.Err(), shared
+	}
+}
+
+// 一次加载多个 key。已经在进行中的 key加入原来的调用，剩下的 key交给一次 fn调用，
+// 其他 Do和 DoContext在 fn执行期间也可以加入这些 key。
+// fn返回每个 key的值或者错误，两个 map里都没有的 key当作 errMissing。
+// 和 DoContext一样，fn在单独的 goroutine里执行，调用方的 ctx被取消时这些 key的错误是 ctx.Err()，
+// 只有 fn负责的每个 key都没有人等待了，传给 fn的 ctx才会被取消。
+// 返回的两个 map合起来包含所有 key；shared是加入了已有调用的 key个数
+func (g *Group) DoMulti(ctx context.Context, keys []string, fn func(ctx context.Context, keys []string) (map[string]interface{}, map[string]error)) (vals map[string]interface{}, errs map[string]error, shared int) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	calls := make(map[string]*call)
+	var ownKeys []string
+	for _, key := range keys {
+		if _, ok := calls[key]; ok {
+			continue
+		}
+		if c, ok := g.m[key]; ok {
+			c.waiters++
+			calls[key] = c
+			shared++
+			continue
+		}
+		c := &call{done: make(chan struct{}), waiters: 1}
+		c.wg.Add(1)
+		g.m[key] = c
+		calls[key] = c
+		ownKeys = append(ownKeys, key)
+	}
+	if len(ownKeys) > 0 {
+		fnCtx, cancel := context.WithCancel(context.Background())
+		left := len(ownKeys) // 还有人等待的 key个数，在 g.mu下修改
+		for _, key := range ownKeys {
+			calls[key].cancel = func() {
+				if left--; left == 0 {
+					cancel()
+				}
+			}
+		}
+		go g.runMulti(fnCtx, cancel, calls, ownKeys, fn)
+	}
+	g.mu.Unlock()
+
+	vals = make(map[string]interface{}, len(calls))
+	errs = make(map[string]error)
+	for key, c := range calls {
+		select {
+		case <-c.done:
+			setResult(vals, errs, key, c.val, c.err)
+		case <-ctx.Done():
+			g.abandon(key, c)
+			errs[key] = ctx.Err()
+		}
+	}
+	return vals, errs, shared
+}
+
+func (g *Group) runMulti(ctx context.Context, cancel context.CancelFunc, calls map[string]*call, keys []string, fn func(ctx context.Context, keys []string) (map[string]interface{}, map[string]error)) {
+	vals, errs := fn(ctx, keys)
+	cancel()
+	for _, key := range keys {
+		c := calls[key]
+		if v, ok := vals[key]; ok {
+			c.val = v
+		} else if err, ok := errs[key]; ok {
+			c.err = err
+		} else {
+			c.err = errMissing
+		}
+	}
+
+	// 先从 g.m里删除再通知等待者，DoMulti返回时这些 key已经不在进行中了
+	g.mu.Lock()
+	for _, key := range keys {
+		if g.m[key] == calls[key] {
+			delete(g.m, key)
+		}
+	}
+	g.mu.Unlock()
+	for _, key := range keys {
+		calls[key].wg.Done()
+		close(calls[key].done)
+	}
+}
+
+// 调用方不再等待 c的结果，所有调用方都放弃时取消 fn的 ctx
+func (g *Group) abandon(key string, c *call) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.waiters--
+	if c.waiters == 0 && c.cancel != nil {
+		c.cancel()
+		// 已经取消的 call不能再被后来的调用方加入
+		if g.m[key] == c {
+			delete(g.m, key)
+		}
+	}
+}
+
+// DoMulti的 fn没有返回某个 key的结果
+var errMissing = errors.New("singleflight: no result for key")
+
+func setResult(vals map[string]interface{}, errs map[string]error, key string, val interface{}, err error) {
+	if err != nil {
+		errs[key] = err
+	} else {
+		vals[key] = val
+	}
+}
+
+func (g *Group) run(ctx context.Context, c *call, key string, fn func(ctx context.Context) (interface{}, error)) {
+	c.val, c.err = fn(ctx)
+	c.cancel()
+	c.wg.Done()
+	close(c.done)
+
+	g.mu.Lock()
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
+	g.mu.Unlock()
+}
+
+// 正在进行中的调用个数
+func (g *Group) InFlight() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.m)
+}
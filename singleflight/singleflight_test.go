@@ -1,9 +1,13 @@
 package singleflight
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
 	"sync"
 	"testing"
+	"time"
 )
 
 // var ExecNum = 0
@@ -63,3 +67,210 @@ func TestDoCase3(t *testing.T) {
 		t.Error("singleFlight err")
 	}
 }
+
+func TestDoForget(t *testing.T) {
+	var g Group
+	v, _ := g.Do("key", func() (interface{}, error) {
+		return "old", nil
+	})
+	if v != "old" {
+		t.Fatalf("Do = %v, want old", v)
+	}
+	// 上一次调用已经结束，同一个 key应该重新调用 fn
+	v, _ = g.Do("key", func() (interface{}, error) {
+		return "new", nil
+	})
+	if v != "new" {
+		t.Fatalf("Do after finished call = %v, want new", v)
+	}
+}
+
+func TestDoContextAbandon(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-release:
+			return "bar", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		_, err, _ := g.DoContext(ctx1, "key", fn)
+		errc <- err
+	}()
+	for g.InFlight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// 第二个调用方加入后，第一个调用方放弃，不能影响第二个
+	resc := make(chan interface{})
+	go func() {
+		v, err, shared := g.DoContext(context.Background(), "key", fn)
+		if err != nil || !shared {
+			t.Errorf("DoContext err = %v, shared = %v", err, shared)
+		}
+		resc <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel1()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("abandoned DoContext err = %v, want %v", err, context.Canceled)
+	}
+	close(release)
+	if v := <-resc; v != "bar" {
+		t.Fatalf("DoContext = %v, want bar", v)
+	}
+}
+
+func TestDoContextCancelAll(t *testing.T) {
+	var g Group
+	fnCanceled := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err, _ := g.DoContext(ctx, "key", func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done() // 唯一的调用方放弃后，fn的 ctx也应该被取消
+		close(fnCanceled)
+		return nil, ctx.Err()
+	})
+	if err != context.Canceled {
+		t.Fatalf("DoContext err = %v, want %v", err, context.Canceled)
+	}
+	select {
+	case <-fnCanceled:
+	case <-time.After(time.Second):
+		t.Fatalf("fn ctx is not canceled after all callers abandoned")
+	}
+}
+
+func TestDoThenDoContext(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	go g.Do("key", func() (interface{}, error) {
+		<-release
+		return "bar", nil
+	})
+	for g.InFlight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// DoContext加入 Do创建的 call，Do的 fn返回后也要能拿到结果
+	resc := make(chan interface{})
+	go func() {
+		v, err, shared := g.DoContext(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+			return "baz", nil
+		})
+		if err != nil || !shared {
+			t.Errorf("DoContext err = %v, shared = %v", err, shared)
+		}
+		resc <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	select {
+	case v := <-resc:
+		if v != "bar" {
+			t.Fatalf("DoContext = %v, want bar", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("DoContext joined to Do never returned")
+	}
+}
+
+func TestDoMulti(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	go g.DoContext(context.Background(), "b", func(ctx context.Context) (interface{}, error) {
+		<-release
+		return "b-single", nil
+	})
+	for g.InFlight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// DoMulti执行期间，单个 key的 Do加入 DoMulti的调用
+	var doVal interface{}
+	doDone := make(chan struct{})
+	var fnKeys []string
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+	vals, errs, shared := g.DoMulti(context.Background(), []string{"a", "b", "c", "a"}, func(ctx context.Context, keys []string) (map[string]interface{}, map[string]error) {
+		fnKeys = keys
+		go func() {
+			doVal, _ = g.Do("a", func() (interface{}, error) { return "a-single", nil })
+			close(doDone)
+		}()
+		for waiters := 1; waiters < 2; { // 等 Do加入
+			time.Sleep(time.Millisecond)
+			g.mu.Lock()
+			waiters = g.m["a"].waiters
+			g.mu.Unlock()
+		}
+		return map[string]interface{}{"a": "a-multi"}, nil
+	})
+	<-doDone
+	if !reflect.DeepEqual(fnKeys, []string{"a", "c"}) || shared != 1 {
+		t.Fatalf("fn keys = %v, shared = %d, want [a c], 1", fnKeys, shared)
+	}
+	if vals["a"] != "a-multi" || vals["b"] != "b-single" || !errors.Is(errs["c"], errMissing) {
+		t.Fatalf("DoMulti = %v, %v", vals, errs)
+	}
+	if doVal != "a-multi" {
+		t.Fatalf("Do joined to DoMulti = %v, want a-multi", doVal)
+	}
+	if n := g.InFlight(); n != 0 {
+		t.Fatalf("%d calls still in flight", n)
+	}
+}
+
+// DoMulti的调用方被取消，加入同一个 key的 DoContext还能拿到结果，fn的 ctx没有被取消
+func TestDoMultiCanceled(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	multiDone := make(chan map[string]error)
+	go func() {
+		_, errs, _ := g.DoMulti(ctx, []string{"a"}, func(ctx context.Context, keys []string) (map[string]interface{}, map[string]error) {
+			<-release
+			if ctx.Err() != nil {
+				return nil, map[string]error{"a": ctx.Err()}
+			}
+			return map[string]interface{}{"a": "a-multi"}, nil
+		})
+		multiDone <- errs
+	}()
+	for g.InFlight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	joined := make(chan interface{})
+	go func() {
+		v, _, _ := g.DoContext(context.Background(), "a", func(ctx context.Context) (interface{}, error) {
+			return "a-single", nil
+		})
+		joined <- v
+	}()
+	for waiters := 1; waiters < 2; { // 等 DoContext加入
+		time.Sleep(time.Millisecond)
+		g.mu.Lock()
+		waiters = g.m["a"].waiters
+		g.mu.Unlock()
+	}
+	cancel()
+	if errs := <-multiDone; !errors.Is(errs["a"], context.Canceled) {
+		t.Fatalf("canceled DoMulti errs = %v, want context.Canceled", errs)
+	}
+	close(release)
+	if v := <-joined; v != "a-multi" {
+		t.Fatalf("DoContext joined to a canceled DoMulti = %v, want a-multi", v)
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"module/geecache"
 	"net/http"
+	"time"
 )
 
 var db = map[string]string{
@@ -22,23 +25,52 @@ func createGroup() *geecache.Group {
 			if v, ok := db[key]; ok {
 				return []byte(v), nil
 			}
-			return nil, fmt.Errorf("%s not exist", key)
-		}))
+			return nil, fmt.Errorf("%w: %s not exist", geecache.ErrNotFound, key) // 用 ErrNotFound告诉其他节点不用再查了
+		}),
+		geecache.WithLogger(geecache.NewStdLogger(nil, geecache.LevelDebug)),
+		geecache.WithNegativeCache(10*time.Second, 1<<20)) // 不存在的 key在 10秒内不再查 SlowDB
 }
 
 func startCacheServer(addr string, addrs []string, gee *geecache.Group) {
 	peerserver := geecache.NewHTTPPool(addr) // peerserver就是 httppool实例
-	peerserver.Set(addrs...)                 // 这里是传入所有节点url
-	gee.RegisterPeers(peerserver)            // peerserver也是PeerPicker，因为httppool实现了 PickPeeer方法
+	peerserver.SetLogger(geecache.NewStdLogger(nil, geecache.LevelDebug))
+	peerserver.SetTransport(geecache.TransportOptions{Timeout: 3 * time.Second}) // 请求其他节点最多等 3秒
+	peerserver.SetBreaker(geecache.BreakerPolicy{ // 节点连续失败时直接本地加载，不再等它
+		OnStateChange: func(peer string, from, to geecache.BreakerState) {
+			log.Printf("breaker of %s: %v -> %v", peer, from, to)
+		},
+	})
+	peerserver.Set(addrs...)      // 这里是传入所有节点url
+	gee.RegisterPeers(peerserver) // peerserver也是PeerPicker，因为httppool实现了 PickPeeer方法
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", peerserver.MetricsHandler()) // Prometheus指标
+	peerserver.StartHealthCheck(geecache.HealthCheck{}) // 定期探测其他节点，挂掉的节点不再分配 key
+	mux.HandleFunc("/peers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(peerserver.PeerStates())
+	})
+	mux.Handle("/_geecache/", peerserver)
 	log.Println("geecache is running at: ", addr)
-	log.Fatal(http.ListenAndServe(addr[7:], peerserver))
+	log.Fatal(http.ListenAndServe(addr[7:], mux))
 }
 
 func startAPIServer(apiAddr string, gee *geecache.Group) {
 	http.Handle("/api", http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			key := r.URL.Query().Get("key")
-			view, err := gee.Get(key)
+			if r.Method == http.MethodDelete { // 删除缓存，并通知 key所属的节点
+				if err := gee.Remove(key); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			view, err := gee.GetContext(r.Context(), key) // 客户端断开后不再继续等待
+			if errors.Is(err, geecache.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -0,0 +1,114 @@
+package tinylfu
+
+// count-min sketch的行数，每个 key在每一行有一个计数器，估计值取最小的那个
+const depth = 4
+
+// 计数器的最大值，TinyLFU只需要区分冷热，不需要准确的次数
+const maxCount = 15
+
+// 不同行用不同的种子，让同一个 key在每一行落到不同的位置
+var seeds = [depth]uint64{0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325}
+
+// TinyLFU的访问频率统计，由 count-min sketch和 doorkeeper组成。
+// doorkeeper是一个布隆过滤器，key第一次出现只记在 doorkeeper里，
+// 第二次出现才进 sketch，大量只访问一次的 key不会把 sketch的计数器弄脏。
+// 每记录 10 * 宽度 次访问，所有计数器减半、doorkeeper清空，让以前的热点慢慢冷下来
+type Filter struct {
+	sketch     [depth][]uint8
+	doorkeeper []uint64 // 位图
+	mask       uint64   // 宽度减一，宽度是 2的幂
+	additions  int      // 上一次减半之后记录的访问次数
+	sampleSize int      // 记录这么多次之后减半
+}
+
+// counters是预计的 key个数，sketch每一行的宽度取不小于它的 2的幂
+func NewFilter(counters int) *Filter {
+	width := 16
+	for width < counters {
+		width <<= 1
+	}
+	f := &Filter{
+		doorkeeper: make([]uint64, width/64+1),
+		mask:       uint64(width - 1),
+		sampleSize: 10 * width,
+	}
+	for i := range f.sketch {
+		f.sketch[i] = make([]uint8, width)
+	}
+	return f
+}
+
+// 第 i个哈希位置
+func (f *Filter) index(h uint64, i int) uint64 {
+	x := (h ^ seeds[i]) * 0x9e3779b97f4a7c15
+	x ^= x >> 32
+	return x & f.mask
+}
+
+func (f *Filter) doorkeeperHas(h uint64) bool {
+	for i := 0; i < 2; i++ {
+		idx := f.index(h, i)
+		if f.doorkeeper[idx/64]&(1<<(idx%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// 记录一次访问，h是 key的哈希值
+func (f *Filter) Increment(h uint64) {
+	if !f.doorkeeperHas(h) {
+		for i := 0; i < 2; i++ {
+			idx := f.index(h, i)
+			f.doorkeeper[idx/64] |= 1 << (idx % 64)
+		}
+	} else {
+		for i := range f.sketch {
+			idx := f.index(h, i)
+			if f.sketch[i][idx] < maxCount {
+				f.sketch[i][idx]++
+			}
+		}
+	}
+	f.additions++
+	if f.additions >= f.sampleSize {
+		f.reset()
+	}
+}
+
+// 估计的访问次数，doorkeeper里有算一次
+func (f *Filter) Estimate(h uint64) int {
+	min := maxCount
+	for i := range f.sketch {
+		if c := int(f.sketch[i][f.index(h, i)]); c < min {
+			min = c
+		}
+	}
+	if f.doorkeeperHas(h) {
+		min++
+	}
+	return min
+}
+
+// 候选 key是否应该替换掉淘汰候选 victim，候选的访问频率更高才替换
+func (f *Filter) Admit(candidate, victim uint64) bool {
+	return f.Estimate(candidate) > f.Estimate(victim)
+}
+
+// sketch和 doorkeeper占用的内存
+func (f *Filter) Bytes() int64 {
+	return int64(len(f.sketch)*len(f.sketch[0]) + len(f.doorkeeper)*8)
+}
+
+// 所有计数器减半，清空 doorkeeper
+func (f *Filter) reset() {
+	for i := range f.sketch {
+		for j := range f.sketch[i] {
+			f.sketch[i][j] >>= 1
+		}
+	}
+	for i := range f.doorkeeper {
+		f.doorkeeper[i] = 0
+	}
+	f.additions /= 2
+}
@@ -0,0 +1,176 @@
+package tinylfu
+
+import (
+	"module/lru"
+	"time"
+)
+
+// W-TinyLFU：新 key先进入一个很小的窗口 LRU（maxBytes的 windowPercent%），
+// 从窗口里淘汰出来的 key再经过 TinyLFU准入过滤，才能进入主 LRU。
+// 主 LRU满了的时候，候选 key的访问频率要比它会挤掉的所有 key的频率之和还高才加入，
+// 否则直接丢掉。这样只访问一次的大值不会把热点数据挤出去，
+// 窗口让刚出现的 key有机会积累几次访问。maxBytes太小、窗口不到 1字节时没有窗口
+type Cache[K comparable, V any] struct {
+	window   *lru.Cache[K, windowItem[V]] // 没有容量限制，超过 windowBytes时由 AddWithTTL移出
+	main     *lru.Cache[K, V]
+	maxBytes int64
+	winBytes int64
+	size     func(key K, value V) int64
+	hash     func(key K) uint64
+	filter   *Filter
+	rejected int64 // 没有通过准入的次数
+}
+
+// 窗口占总内存的百分比，和 Caffeine的默认值一样
+const windowPercent = 1
+
+// 窗口里的值要记住过期时间，移到主 LRU时用
+type windowItem[V any] struct {
+	value  V
+	expire time.Time
+}
+
+// maxBytes和 size见 lru.NewCache，counters是预计的 key个数，
+// 用来决定 sketch的大小，hash计算 key的哈希值
+func NewCache[K comparable, V any](maxBytes int64, counters int, size func(key K, value V) int64, hash func(key K) uint64) *Cache[K, V] {
+	if size == nil {
+		size = func(K, V) int64 { return 1 }
+	}
+	winBytes := maxBytes * windowPercent / 100
+	return &Cache[K, V]{
+		window: lru.NewCache(0, func(key K, it windowItem[V]) int64 {
+			return size(key, it.value)
+		}),
+		main:     lru.NewCache(maxBytes-winBytes, size),
+		maxBytes: maxBytes,
+		winBytes: winBytes,
+		size:     size,
+		hash:     hash,
+		filter:   NewFilter(counters),
+	}
+}
+
+// 窗口和主 LRU都是 lru.Cache，节点开销就是 lru.EntryOverhead。
+// 窗口里的节点多一个过期时间，窗口很小，按主 LRU的节点算
+func EntryOverhead[K comparable, V any]() int64 {
+	return lru.EntryOverhead[K, V]()
+}
+
+// FNV-1a，string key的哈希函数
+func StringHash(key string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= prime64
+	}
+	return h
+}
+
+// 查找 key，不管是否命中都记录一次访问。
+// 缓存未命中时调用方一般会接着 Add，Add里不再记录
+func (c *Cache[K, V]) Get(key K) (value V, ok bool) {
+	c.filter.Increment(c.hash(key))
+	if it, ok := c.window.Get(key); ok {
+		return it.value, true
+	}
+	return c.main.Get(key)
+}
+
+// key是否存在并且没有过期，不记录访问
+func (c *Cache[K, V]) Contains(key K) bool {
+	return c.window.Contains(key) || c.main.Contains(key)
+}
+
+func (c *Cache[K, V]) Add(key K, value V) {
+	c.AddWithTTL(key, value, 0)
+}
+
+// 加入或者更新 key，ttl <= 0 表示永不过期。已有的 key直接更新，
+// 新 key放进窗口，窗口满了把最旧的 key交给准入过滤
+func (c *Cache[K, V]) AddWithTTL(key K, value V, ttl time.Duration) {
+	if c.window.Contains(key) {
+		c.window.AddWithTTL(key, windowItem[V]{value, expireAt(ttl)}, ttl)
+		return
+	}
+	if c.main.Contains(key) || c.maxBytes == 0 {
+		c.main.AddWithTTL(key, value, ttl)
+		return
+	}
+	c.window.AddWithTTL(key, windowItem[V]{value, expireAt(ttl)}, ttl)
+	for c.window.Bytes() > c.winBytes {
+		candidate, it, ok := c.window.Oldest()
+		if !ok {
+			break
+		}
+		c.window.Remove(candidate)
+		c.admit(candidate, it)
+	}
+}
+
+func expireAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// 从窗口出来的 key，主 LRU放得下就直接加入，
+// 否则和它会挤掉的所有 key比较访问频率
+func (c *Cache[K, V]) admit(key K, it windowItem[V]) {
+	var ttl time.Duration
+	if !it.expire.IsZero() {
+		if ttl = time.Until(it.expire); ttl <= 0 {
+			return
+		}
+	}
+	if need := c.main.Bytes() + c.size(key, it.value) - (c.maxBytes - c.winBytes); need > 0 {
+		var victims int
+		for _, victim := range c.main.Victims(need) {
+			victims += c.filter.Estimate(c.hash(victim))
+		}
+		if c.filter.Estimate(c.hash(key)) <= victims {
+			c.rejected++
+			return
+		}
+	}
+	c.main.AddWithTTL(key, it.value, ttl)
+}
+
+// 主动删除 key
+func (c *Cache[K, V]) Remove(key K) {
+	c.window.Remove(key)
+	c.main.Remove(key)
+}
+
+// 删除所有已经过期的节点，返回删除的个数
+func (c *Cache[K, V]) RemoveExpired() int {
+	return c.window.RemoveExpired() + c.main.RemoveExpired()
+}
+
+func (c *Cache[K, V]) Len() int {
+	return c.window.Len() + c.main.Len()
+}
+
+// 当前已经使用的内存
+func (c *Cache[K, V]) Bytes() int64 {
+	return c.window.Bytes() + c.main.Bytes()
+}
+
+// 估计的堆内存。size里加上了 EntryOverhead时，是窗口、主 LRU和 Filter的和
+func (c *Cache[K, V]) HeapBytes() int64 {
+	return c.Bytes() + c.filter.Bytes()
+}
+
+// 被淘汰的节点总数，不包括没有通过准入的
+func (c *Cache[K, V]) Evictions() int64 {
+	return c.window.Evictions() + c.main.Evictions()
+}
+
+// 没有通过准入、没有加入缓存的次数
+func (c *Cache[K, V]) Rejected() int64 {
+	return c.rejected
+}
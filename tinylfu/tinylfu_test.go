@@ -0,0 +1,142 @@
+package tinylfu
+
+import (
+	"math/rand"
+	"module/lru"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	f := NewFilter(64)
+	h := StringHash("k1")
+	f.Increment(h) // 第一次只记在 doorkeeper里
+	if e := f.Estimate(h); e != 1 {
+		t.Fatalf("Estimate after 1 increment = %d, want 1", e)
+	}
+	for i := 0; i < 4; i++ {
+		f.Increment(h)
+	}
+	if e := f.Estimate(h); e != 5 {
+		t.Fatalf("Estimate after 5 increments = %d, want 5", e)
+	}
+	f.reset()
+	if e := f.Estimate(h); e != 2 {
+		t.Fatalf("Estimate after reset = %d, want 2", e)
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	c := NewCache[string, int](2, 64, nil, StringHash)
+	for _, key := range []string{"hot1", "hot2"} {
+		for i := 0; i < 3; i++ {
+			if _, ok := c.Get(key); !ok {
+				c.Add(key, i)
+			}
+		}
+	}
+	// 只访问一次的 key不能把热点挤出去
+	for i := 0; i < 100; i++ {
+		key := "once" + strconv.Itoa(i)
+		if _, ok := c.Get(key); !ok {
+			c.Add(key, i)
+		}
+	}
+	if !c.Contains("hot1") || !c.Contains("hot2") {
+		t.Fatalf("hot keys should not be evicted by one-hit wonders")
+	}
+	if c.Rejected() != 100 {
+		t.Fatalf("Rejected = %d, want 100", c.Rejected())
+	}
+}
+
+// 大的值要挤掉好几个 key，频率要比它们的总和还高才能进入
+func TestAdmissionBigValue(t *testing.T) {
+	size := func(key string, value string) int64 { return int64(len(value)) }
+	c := NewCache[string, string](101, 64, size, StringHash) // 窗口 1字节，主 LRU 100字节
+	small := strings.Repeat("x", 10)
+	for i := 0; i < 10; i++ {
+		key := "hot" + strconv.Itoa(i)
+		c.Get(key)
+		c.Get(key)
+		c.Add(key, small)
+	}
+	// big比每个热点 key的频率都高，但是比它要挤掉的 5个加起来低
+	for i := 0; i < 3; i++ {
+		c.Get("big")
+	}
+	c.Add("big", strings.Repeat("x", 50))
+	if c.Contains("big") || c.Len() != 10 {
+		t.Fatalf("big value admitted over 5 hotter keys, len = %d", c.Len())
+	}
+
+	for i := 0; i < 20; i++ {
+		c.Get("big")
+	}
+	c.Add("big", strings.Repeat("x", 50))
+	if !c.Contains("big") || c.Bytes() > 101 {
+		t.Fatalf("frequent big value not admitted, bytes = %d", c.Bytes())
+	}
+}
+
+// 窗口里的新 key不用经过准入，被访问几次之后就能进入主 LRU
+func TestWindow(t *testing.T) {
+	c := NewCache[string, int](200, 256, nil, StringHash)
+	for i := 0; i < 200; i++ {
+		key := "old" + strconv.Itoa(i)
+		c.Get(key)
+		c.Add(key, i)
+	}
+	c.Add("new", 1)
+	if !c.Contains("new") {
+		t.Fatalf("new key should stay in the window")
+	}
+	for i := 0; i < 5; i++ {
+		c.Get("new")
+	}
+	c.Add("new2", 2) // 把 new挤出窗口，new的频率更高，进入主 LRU
+	c.Add("new3", 3)
+	if !c.Contains("new") || c.Len() != 200 {
+		t.Fatalf("frequent key from the window not admitted, len = %d", c.Len())
+	}
+}
+
+// 同一个 Zipf访问序列，比较 TinyLFU和 LRU的命中率
+func TestHitRatioZipf(t *testing.T) {
+	const (
+		capacity = 1000
+		keys     = 100000
+		requests = 200000
+	)
+	for _, s := range []float64{1.01, 1.1, 1.3} {
+		r := rand.New(rand.NewSource(1))
+		zipf := rand.NewZipf(r, s, 1, keys-1)
+		trace := make([]string, requests)
+		for i := range trace {
+			trace[i] = strconv.FormatUint(zipf.Uint64(), 10)
+		}
+
+		tiny := NewCache[string, struct{}](capacity, capacity, nil, StringHash)
+		plain := lru.NewCache[string, struct{}](capacity, nil)
+		tinyHits, lruHits := 0, 0
+		for _, key := range trace {
+			if _, ok := tiny.Get(key); ok {
+				tinyHits++
+			} else {
+				tiny.Add(key, struct{}{})
+			}
+			if _, ok := plain.Get(key); ok {
+				lruHits++
+			} else {
+				plain.Add(key, struct{}{})
+			}
+		}
+		tinyRatio := float64(tinyHits) / requests
+		lruRatio := float64(lruHits) / requests
+		t.Logf("zipf s=%.2f: tinylfu %.4f, lru %.4f", s, tinyRatio, lruRatio)
+		if tinyRatio <= lruRatio {
+			t.Errorf("zipf s=%.2f: tinylfu hit ratio %.4f should beat lru %.4f", s, tinyRatio, lruRatio)
+		}
+	}
+}